@@ -0,0 +1,139 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// address.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Instance addresses
+
+launched instances are tagged with the name of their launch manifest and their
+index among the instances launched for that name.  commands that take session
+ids (sessions, instances, terminate) also accept addresses of the form
+
+	session-id/name
+	session-id/name/index
+
+which select only the instances of the session launched for the manifest name
+(and with the given index).  indexes start at zero.
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/otitag"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// identifies a session or a subset of its instances.
+type InstanceAddress struct {
+	SessionId SessionId
+	Name      string // empty matches all instances of the session
+	Index     int    // negative matches all instances with Name
+}
+
+func ParseInstanceAddress(s string) (InstanceAddress, error) {
+	a := InstanceAddress{Index: -1}
+	parts := strings.SplitN(s, "/", 3)
+	a.SessionId = SessionId(parts[0])
+	if a.SessionId == "" {
+		return a, fmt.Errorf("invalid address %q: no session id", s)
+	}
+	if len(parts) > 1 {
+		a.Name = parts[1]
+		if a.Name == "" {
+			return a, fmt.Errorf("invalid address %q: no manifest name", s)
+		}
+	}
+	if len(parts) > 2 {
+		i, err := strconv.Atoi(parts[2])
+		if err != nil || i < 0 {
+			return a, fmt.Errorf("invalid address %q: invalid index", s)
+		}
+		a.Index = i
+	}
+	return a, nil
+}
+
+func ParseInstanceAddresses(ss []string) ([]InstanceAddress, error) {
+	as := make([]InstanceAddress, len(ss))
+	for i := range ss {
+		var err error
+		as[i], err = ParseInstanceAddress(ss[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return as, nil
+}
+
+// the distinct session ids of as, in order.
+func AddressSessionIds(as []InstanceAddress) []string {
+	var ids []string
+	seen := make(map[SessionId]bool)
+	for _, a := range as {
+		if !seen[a.SessionId] {
+			seen[a.SessionId] = true
+			ids = append(ids, string(a.SessionId))
+		}
+	}
+	return ids
+}
+
+// the address of inst, or the empty string if inst is not tagged with a
+// session id and manifest name.
+func InstanceAddressOf(inst *awsec2.Instance) string {
+	sid := instanceTag(inst, Config.Ec2Tag(otitag.SessionId))
+	name := instanceTag(inst, Config.Ec2Tag(otitag.IManifest))
+	if sid == "" || name == "" {
+		return ""
+	}
+	addr := sid + "/" + name
+	if index := instanceTag(inst, Config.Ec2Tag(otitag.IIndex)); index != "" {
+		addr += "/" + index
+	}
+	return addr
+}
+
+func (a InstanceAddress) String() string {
+	s := string(a.SessionId)
+	if a.Name != "" {
+		s += "/" + a.Name
+		if a.Index >= 0 {
+			s += "/" + strconv.Itoa(a.Index)
+		}
+	}
+	return s
+}
+
+// true if inst is addressed by a.
+func (a InstanceAddress) Match(inst *awsec2.Instance) bool {
+	if instanceTag(inst, Config.Ec2Tag(otitag.SessionId)) != string(a.SessionId) {
+		return false
+	}
+	if a.Name == "" {
+		return true
+	}
+	if instanceTag(inst, Config.Ec2Tag(otitag.IManifest)) != a.Name {
+		return false
+	}
+	if a.Index < 0 {
+		return true
+	}
+	return instanceTag(inst, Config.Ec2Tag(otitag.IIndex)) == strconv.Itoa(a.Index)
+}
+
+// true if inst is addressed by any of as.
+func MatchAnyAddress(as []InstanceAddress, inst *awsec2.Instance) bool {
+	for _, a := range as {
+		if a.Match(inst) {
+			return true
+		}
+	}
+	return false
+}
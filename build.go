@@ -0,0 +1,134 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// build.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Build images while launching
+
+	oti launch name build=ifmissing [directive ...]
+	oti launch name build=always [directive ...]
+
+the build directive of `oti launch` builds the image for a manifest with
+packer.  with build=ifmissing packer only runs when no image with the name
+exists in the launch region.  with build=always a new image is built on every
+launch.  the packer manifest with the same name in Packer.ManifestDir is
+built (see the oticonfig package) with the credentials oti uses for the
+region, and the image produced in the launch region is tagged with the name,
+the build date and the oti Created tag before instances are launched from it.
+
+the packer manifest decides the regions images are built in.  it is an error
+if it does not produce an image in the launch region.  packer's messages are
+logged as it runs.  packer is interrupted along with oti and cleans up after
+itself before launch stops.
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/otitag"
+	"github.com/bmatsuo/oti/packer"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// the values of the build directive
+const (
+	BuildIfMissing = "ifmissing"
+	BuildAlways    = "always"
+)
+
+// build the packer manifest named name and return the image it produces in
+// the region of ec2.  regionProfile selects the credentials given to packer.
+func BuildImage(ctx context.Context, ec2 *awsec2.EC2, regionProfile, name string) (*awsec2.Image, error) {
+	if Config.Images.NameTag == "" {
+		return nil, fmt.Errorf("no name tag to identify images with")
+	}
+	m, err := Config.PackerManifest(name)
+	if err != nil {
+		return nil, fmt.Errorf("packer manifest: %v", err)
+	}
+	if len(m.Builders) == 0 {
+		return nil, fmt.Errorf("packer manifest %s: no builders", Config.PackerManifestPath(name))
+	}
+	creds, err := RegionCredentials(ec2.Region, regionProfile)
+	if err != nil {
+		return nil, err
+	}
+	env := []string{
+		"AWS_ACCESS_KEY_ID=" + creds.AccessKey,
+		"AWS_SECRET_ACCESS_KEY=" + creds.SecretKey,
+	}
+	if creds.SessionToken != "" {
+		env = append(env, "AWS_SESSION_TOKEN="+creds.SessionToken)
+	}
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("interrupted; image not built")
+	}
+	path := Config.PackerManifestPath(name)
+	Log.Printf("%s: building image with packer (%s)", name, path)
+	outs, err := packer.Build(path, packer.Opts{
+		Env:     env,
+		Context: ctx,
+		UI: func(o packer.Output) {
+			if len(o.Fields) > 1 {
+				Log.Printf("%s: packer: %s", name, strings.TrimSpace(o.Fields[1]))
+			}
+		},
+	})
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("interrupted; packer build %s stopped", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("packer build %s: %v", path, err)
+	}
+
+	var id string
+	for _, art := range packer.Artifacts(outs) {
+		if DEBUG {
+			Log.Printf("%s: packer artifact %s %q", name, art.Builder, art.Id)
+		}
+		if _id := packer.AmazonImageIds(art)[ec2.Region.Name]; _id != "" {
+			id = _id
+		}
+	}
+	if id == "" {
+		return nil, fmt.Errorf("packer build %s: no image built in %s", path, ec2.Region.Name)
+	}
+
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	tags := []awsec2.Tag{
+		{Key: Config.Images.NameTag, Value: name},
+		{Key: Config.Ec2Tag(otitag.Created), Value: timestamp},
+	}
+	if Config.Images.BuildDateTag != "" {
+		tags = append(tags, awsec2.Tag{Key: Config.Images.BuildDateTag, Value: timestamp})
+	}
+	_, err = ec2.CreateTags([]string{id}, tags)
+	if err != nil {
+		return nil, fmt.Errorf("%s: error tagging image: %v", id, err)
+	}
+
+	return WaitImageAvailable(ctx, ec2, regionProfile, id)
+}
+
+// locate the image selected by r in the region of ec2, building it if there
+// are no images with the name.
+func LookupOrBuildImage(ctx context.Context, ec2 *awsec2.EC2, regionProfile string, r *ImageResolver) (*awsec2.Image, error) {
+	images, err := LookupImages(ec2, r.Name, r.Channel)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) > 0 {
+		image, _, err := r.Resolve(ec2, images)
+		return image, err
+	}
+	return BuildImage(ctx, ec2, regionProfile, r.Name)
+}
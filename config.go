@@ -0,0 +1,230 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// config.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Inspect configuration
+
+the "config" command inspects oti's configuration.
+
+	oti config show [path ...]
+	oti config check [-online]
+	oti config init [-file oti.json] [-force] [-discover=false]
+
+config show prints the effective value of each config field and where it came
+from.  when paths are given (e.g. Ec2.TagPrefix) only those fields are shown.
+each field's value is taken from the first of
+
+	-set flags          oti -set Ec2.TagPrefix=com.example. ...
+	environment         OTI_EC2_TAGPREFIX=com.example.
+	the config file     including the selected profile
+	defaults
+
+command flags such as `oti launch -r` and `-keyname` take precedence over all
+of the above.  the environment variable for a field is its path in upper case
+with non-alphanumeric characters replaced by '_' and the prefix OTI_.  region
+fields are named by region, e.g. OTI_EC2_REGIONS_US_EAST_1_KEYNAME.  lists are
+comma separated.  security groups and roles can be given as json.
+
+config check validates the configuration and prints any problems found.
+region names must be known, regions configured more than once need an Id, the
+tag prefix must produce valid tag keys and the packer manifest directory must
+exist.  with -online oti also verifies that the key pairs and security groups
+of each configured region exist, and that images carry the configured tags.
+the exit status is non-zero if any errors (not warnings) are found.
+
+config init prompts for the essential settings (credentials, default region,
+key pair, security groups and image tags) and writes a new config file.  key
+pairs and security groups in the account are listed to choose from unless
+-discover=false is given.  when credentials are entered they are written to a
+separate file readable only by its owner, located relative to the new config
+file.  the secret access key is not echoed.  existing files are not
+overwritten without -force.
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/oticonfig"
+	"github.com/bmatsuo/oti/otiout"
+	"github.com/bmatsuo/oti/otisub"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var config = otisub.Register("config", func(args []string) {
+	fs := otisub.FlagSet(flag.ExitOnError, "config", "show|check|init ...")
+	fs.Parse(args)
+	args = fs.Args()
+
+	if len(args) == 0 {
+		fs.Usage()
+		Log.Fatal("no config command")
+	}
+	switch args[0] {
+	case "show":
+		ConfigShowMain(args[1:])
+	case "check":
+		ConfigCheckMain(args[1:])
+	case "init":
+		ConfigInitMain(args[1:])
+	default:
+		Log.Fatalf("unknown config command %q", args[0])
+	}
+})
+
+// print the effective value of each config field and its source.
+func ConfigShowMain(args []string) {
+	fs := otisub.FlagSet(flag.ExitOnError, "config show", "[path ...]")
+	fs.Parse(args)
+	paths := fs.Args()
+
+	out := NewOutput("{{.Path}}={{.Value}}\t({{.Source}})")
+	for _, f := range Config.Fields() {
+		if len(paths) > 0 && !matchConfigPath(paths, f.Path) {
+			continue
+		}
+		source := ConfigSources[f.Path]
+		if source == "" {
+			source = "default"
+		}
+		WriteOutput(out, otiout.Record{
+			{Name: "Path", Value: f.Path},
+			{Name: "Value", Value: f.Value},
+			{Name: "Source", Value: source},
+			{Name: "Env", Value: f.Env},
+		})
+	}
+	CloseOutput(out)
+}
+
+// true if path is one of paths or a field within one of them.
+func matchConfigPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if strings.EqualFold(p, path) || strings.HasPrefix(strings.ToLower(path), strings.ToLower(p)+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// validate Config, printing each problem found.
+func ConfigCheckMain(args []string) {
+	fs := otisub.FlagSet(flag.ExitOnError, "config check", "")
+	online := fs.Bool("online", false, "verify key pairs, security groups and images in each region")
+	fs.Parse(args)
+
+	problems := Config.Check()
+	if *online {
+		problems = append(problems, CheckConfigOnline()...)
+	}
+
+	var haserrors bool
+	out := NewOutput("{{.Severity}}: {{.Path}}: {{.Message}}")
+	for _, p := range problems {
+		severity := "warning"
+		if !p.Warning {
+			severity = "error"
+			haserrors = true
+		}
+		WriteOutput(out, otiout.Record{
+			{Name: "Severity", Value: severity},
+			{Name: "Path", Value: p.Path},
+			{Name: "Message", Value: p.Message},
+		})
+	}
+	CloseOutput(out)
+	if haserrors {
+		Log.Fatal()
+	}
+}
+
+// verify that the resources named by each configured region exist.
+func CheckConfigOnline() []oticonfig.Problem {
+	var ps []oticonfig.Problem
+	problem := func(path string, warning bool, format string, v ...interface{}) {
+		ps = append(ps, oticonfig.Problem{Path: path, Message: fmt.Sprintf(format, v...), Warning: warning})
+	}
+
+	for i, cr := range Config.Ec2.Regions {
+		path := fmt.Sprintf("Ec2.Regions[%d]", i)
+		region, err := Config.AwsRegion(cr.RegionName)
+		if err != nil {
+			continue // reported by Check
+		}
+		ec2, err := NewRegionProfileEC2(region, cr.Id)
+		if err != nil {
+			problem(path, false, "%v", err)
+			continue
+		}
+
+		if cr.KeyName != "" {
+			_, err := ec2.KeyPairs([]string{cr.KeyName}, nil)
+			if err != nil {
+				problem(path+".KeyName", false, "key pair %q: %v", cr.KeyName, err)
+			}
+		}
+
+		for j, sg := range cr.SecurityGroups {
+			if sg == (oticonfig.Ec2SecurityGroup{}) {
+				continue
+			}
+			group := awsec2.SecurityGroup{Id: sg.Id, Name: sg.Name}
+			_, err := ec2.SecurityGroups([]awsec2.SecurityGroup{group}, nil)
+			if err != nil {
+				problem(fmt.Sprintf("%s.SecurityGroups[%d]", path, j), false, "%v", err)
+			}
+		}
+
+		nametag := Config.Images.NameTag
+		if nametag == "" {
+			continue
+		}
+		filter := awsec2.NewFilter()
+		filter.Add("tag-key", nametag)
+		resp, err := ec2.Images(nil, filter)
+		if err != nil {
+			problem(path, false, "images: %v", err)
+			continue
+		}
+		if len(resp.Images) == 0 {
+			problem("Images.NameTag", true, "no images tagged %q in %s", nametag, region.Name)
+			continue
+		}
+		for _, tag := range []struct{ path, key string }{
+			{"Images.BuildDateTag", Config.Images.BuildDateTag},
+			{"Images.VersionTag", Config.Images.VersionTag},
+		} {
+			if tag.key == "" {
+				continue
+			}
+			var missing []string
+			for _, img := range resp.Images {
+				if imageTag(&img, tag.key) == "" {
+					missing = append(missing, img.Id)
+				}
+			}
+			if len(missing) > 0 {
+				problem(tag.path, true, "images in %s missing tag %q: %s",
+					region.Name, tag.key, strings.Join(missing, " "))
+			}
+		}
+	}
+
+	return ps
+}
+
+func imageTag(img *awsec2.Image, key string) string {
+	for _, tag := range img.Tags {
+		if tag.Key == key {
+			return tag.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,304 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// configinit.go [created: Mon, 19 Oct 2026]
+
+package main
+
+import (
+	"github.com/bmatsuo/oti/oticonfig"
+	"github.com/bmatsuo/oti/otisub"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// interactively write a new config file.  see `oti config -h`
+func ConfigInitMain(args []string) {
+	fs := otisub.FlagSet(flag.ExitOnError, "config init", "")
+	path := fs.String("file", oticonfig.FileName, "config file to write")
+	force := fs.Bool("force", false, "overwrite existing files")
+	discover := fs.Bool("discover", true, "list key pairs and security groups in the account")
+	fs.Parse(args)
+
+	if !*force {
+		if _, err := os.Stat(*path); err == nil {
+			Log.Fatalf("%s exists; use -force to overwrite it", *path)
+		}
+	}
+
+	p := &prompter{r: bufio.NewReader(os.Stdin), w: os.Stderr}
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		p.tty = os.Stdin
+	}
+	c, err := ConfigInit(p, *path, *force, *discover)
+	if err != nil {
+		Log.Fatal(err)
+	}
+
+	for _, problem := range c.Check() {
+		Log.Printf("warning: %v", problem)
+	}
+
+	js, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		Log.Fatal(err)
+	}
+	err = writeFile(*path, append(js, '\n'), 0644, *force)
+	if err != nil {
+		Log.Fatal(err)
+	}
+	Log.Printf("wrote %s. run `oti config check -online` to verify it", *path)
+}
+
+// build a configuration for the config file at path from the answers to
+// prompts.  if credentials are entered they are written to the configured
+// AwsKeyPath, which like other relative paths in a config file is relative to
+// the directory of path.
+func ConfigInit(p *prompter, path string, force, discover bool) (*oticonfig.C, error) {
+	c := &oticonfig.C{
+		AwsKeyPath: Config.AwsKeyPath,
+		Ec2: oticonfig.Ec2{
+			TagPrefix:     Config.Ec2.TagPrefix,
+			DefaultRegion: Config.Ec2.DefaultRegion,
+		},
+	}
+
+	source, err := p.choose("aws credentials source", oticonfig.CredentialSources, "file")
+	if err != nil {
+		return nil, err
+	}
+	c.Credentials.Sources = []string{source}
+	switch source {
+	case "file":
+		c.AwsKeyPath, err = p.ask("aws credentials file (relative to the config file)", c.AwsKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		keypath := c.AwsKeyPath
+		if !filepath.IsAbs(keypath) {
+			keypath = filepath.Join(filepath.Dir(path), keypath)
+		}
+		err = initCredentialsFile(p, keypath, force)
+	case "shared":
+		c.Credentials.SharedProfile, err = p.ask("shared credentials profile", "default")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		c.Ec2.DefaultRegion, err = p.ask("default region", c.Ec2.DefaultRegion)
+		if err != nil {
+			return nil, err
+		}
+		_, err = c.AwsRegion(c.Ec2.DefaultRegion)
+		if err == nil {
+			break
+		}
+		p.printf("%v\n", err)
+	}
+	region, _ := c.AwsRegion(c.Ec2.DefaultRegion)
+
+	var keynames, groups []string
+	if discover {
+		// the new configuration's credentials are used for discovery.
+		Config = c
+		ec2, err := NewEC2(region)
+		if err == nil {
+			keynames, groups, err = discoverResources(ec2)
+		}
+		if err != nil {
+			p.printf("unable to list key pairs and security groups: %v\n", err)
+		}
+	}
+
+	cr := oticonfig.Ec2Region{RegionName: region.Name}
+	if len(keynames) > 0 {
+		p.printf("key pairs in %s: %s\n", region.Name, strings.Join(keynames, " "))
+	}
+	def := ""
+	if len(keynames) == 1 {
+		def = keynames[0]
+	}
+	cr.KeyName, err = p.ask("key pair", def)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(groups) > 0 {
+		p.printf("security groups in %s: %s\n", region.Name, strings.Join(groups, " "))
+	}
+	sgs, err := p.ask("security groups (comma separated)", "")
+	if err != nil {
+		return nil, err
+	}
+	for _, sg := range strings.Split(sgs, ",") {
+		sg = strings.TrimSpace(sg)
+		if sg == "" {
+			continue
+		}
+		group := GuessSecurityGroup(sg)
+		cr.SecurityGroups = append(cr.SecurityGroups, oticonfig.Ec2SecurityGroup{Id: group.Id, Name: group.Name})
+	}
+	c.Ec2.Regions = []oticonfig.Ec2Region{cr}
+
+	c.Images.NameTag, err = p.ask("image name tag", "Name")
+	if err != nil {
+		return nil, err
+	}
+	c.Images.BuildDateTag, err = p.ask("image build date tag", "BuildTime")
+	if err != nil {
+		return nil, err
+	}
+	c.Images.VersionTag, err = p.ask("image version tag (optional)", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// prompt for an access key and write it to path.
+func initCredentialsFile(p *prompter, path string, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		p.printf("using existing credentials in %s\n", path)
+		return nil
+	}
+	var k oticonfig.AwsKey
+	var err error
+	k.AccessKey, err = p.ask("aws access key id", "")
+	if err != nil {
+		return err
+	}
+	k.SecretKey, err = p.askSecret("aws secret access key")
+	if err != nil {
+		return err
+	}
+	if k.AccessKey == "" || k.SecretKey == "" {
+		return fmt.Errorf("an access key id and secret access key are required")
+	}
+	js, err := json.MarshalIndent(k, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, append(js, '\n'), 0400, force)
+}
+
+// returns the names of the key pairs and security groups visible to ec2.
+func discoverResources(ec2 *awsec2.EC2) (keynames, groups []string, err error) {
+	kresp, err := ec2.KeyPairs(nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, k := range kresp.Keys {
+		keynames = append(keynames, k.Name)
+	}
+	gresp, err := ec2.SecurityGroups(nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, g := range gresp.Groups {
+		groups = append(groups, g.Name)
+	}
+	return keynames, groups, nil
+}
+
+// write a new file.  an existing file is replaced only if force is true.
+func writeFile(path string, p []byte, perm os.FileMode, force bool) error {
+	if force {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(p)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// asks questions on w and reads answers from r.  tty is the terminal r
+// reads from, if any.
+type prompter struct {
+	r   *bufio.Reader
+	w   io.Writer
+	tty *os.File
+}
+
+func (p *prompter) printf(format string, v ...interface{}) {
+	fmt.Fprintf(p.w, format, v...)
+}
+
+// returns the answer to question, or def if the answer is empty.
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		p.printf("%s [%s]: ", question, def)
+	} else {
+		p.printf("%s: ", question)
+	}
+	line, err := p.r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("reading answer: %v", err)
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// like ask but the answer is not echoed by the terminal and there is no
+// default.  if echo cannot be disabled a warning is printed first.
+func (p *prompter) askSecret(question string) (string, error) {
+	if p.tty != nil {
+		err := stty(p.tty, "-echo")
+		if err != nil {
+			p.printf("warning: the answer will be shown (%v)\n", err)
+		} else {
+			defer func() {
+				stty(p.tty, "echo")
+				p.printf("\n")
+			}()
+		}
+	}
+	return p.ask(question, "")
+}
+
+func stty(tty *os.File, arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = tty
+	return cmd.Run()
+}
+
+// like ask but the answer must be one of choices.
+func (p *prompter) choose(question string, choices []string, def string) (string, error) {
+	question = fmt.Sprintf("%s (%s)", question, strings.Join(choices, ", "))
+	for {
+		answer, err := p.ask(question, def)
+		if err != nil {
+			return "", err
+		}
+		for _, choice := range choices {
+			if answer == choice {
+				return answer, nil
+			}
+		}
+		p.printf("expected one of: %s\n", strings.Join(choices, ", "))
+	}
+}
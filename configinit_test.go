@@ -0,0 +1,50 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigInitKeyPath(t *testing.T) {
+	dir := t.TempDir()
+	answers := strings.Join([]string{
+		"file",      // credentials source
+		"keys.json", // credentials file
+		"AKIDTEST",
+		"secretkey",
+		"us-east-1",
+		"oti", // key pair
+		"",    // security groups
+		"", "", "",
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	p := &prompter{r: bufio.NewReader(strings.NewReader(answers)), w: &out}
+
+	c, err := ConfigInit(p, filepath.Join(dir, "oti.json"), false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the path is stored relative to the config file and the key is written
+	// there, wherever oti runs.
+	if c.AwsKeyPath != "keys.json" {
+		t.Errorf("AwsKeyPath %q", c.AwsKeyPath)
+	}
+	p2, err := ioutil.ReadFile(filepath.Join(dir, "keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(p2, []byte("secretkey")) {
+		t.Errorf("credentials file %s", p2)
+	}
+	if strings.Contains(out.String(), "secretkey") {
+		t.Errorf("secret key printed: %s", out.String())
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// ec2query.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Raw EC2 requests
+
+goamz does not implement every ec2 action (e.g. ModifySnapshotAttribute) nor
+decode every field of the responses it does implement (e.g. the creationDate
+of images).  such requests are signed and sent here using the credentials of
+an ec2 client.
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/oticreds"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the ec2 api version used for requests goamz does not implement
+const ec2APIVersion = "2014-02-01"
+
+// send an ec2 query api request for the action in form to the region of ec2,
+// signed with its credentials.  the response body is returned.
+func EC2Query(ec2 *awsec2.EC2, form url.Values) ([]byte, error) {
+	creds := &oticreds.Credentials{
+		AccessKey:    ec2.Auth.AccessKey,
+		SecretKey:    ec2.Auth.SecretKey,
+		SessionToken: ec2.Auth.Token(),
+	}
+	form.Set("Version", ec2APIVersion)
+	body := form.Encode()
+
+	req, err := http.NewRequest("POST", ec2.Region.EC2Endpoint, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	oticreds.SignV4(req, []byte(body), creds, ec2.Region.Name, "ec2", time.Now())
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	p, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return p, nil
+	}
+	var ec2err struct {
+		Code    string `xml:"Errors>Error>Code"`
+		Message string `xml:"Errors>Error>Message"`
+	}
+	xml.Unmarshal(p, &ec2err)
+	if ec2err.Code != "" {
+		return nil, fmt.Errorf("%s: %s", ec2err.Code, ec2err.Message)
+	}
+	return nil, fmt.Errorf("%s: %s", form.Get("Action"), resp.Status)
+}
+
+// returns the creation dates of the images with the given ids.
+func DescribeImageCreationDates(ec2 *awsec2.EC2, ids []string) (map[string]time.Time, error) {
+	dates := make(map[string]time.Time, len(ids))
+	if len(ids) == 0 {
+		return dates, nil
+	}
+	form := url.Values{}
+	form.Set("Action", "DescribeImages")
+	for i, id := range ids {
+		form.Set("ImageId."+strconv.Itoa(i+1), id)
+	}
+	p, err := EC2Query(ec2, form)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Images []struct {
+			Id           string `xml:"imageId"`
+			CreationDate string `xml:"creationDate"`
+		} `xml:"imagesSet>item"`
+	}
+	err = xml.Unmarshal(p, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("DescribeImages: %v", err)
+	}
+	for _, img := range resp.Images {
+		if img.CreationDate == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, img.CreationDate)
+		if err != nil {
+			return nil, fmt.Errorf("%s: creation date: %v", img.Id, err)
+		}
+		dates[img.Id] = t
+	}
+	return dates, nil
+}
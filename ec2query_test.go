@@ -0,0 +1,89 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/crowdmob/goamz/aws"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const describeImagesResponse = `<DescribeImagesResponse xmlns="http://ec2.amazonaws.com/doc/2014-02-01/">
+  <requestId>59dbff89-35bd-4eac-99ed-be587EXAMPLE</requestId>
+  <imagesSet>
+    <item>
+      <imageId>ami-11111111</imageId>
+      <imageState>available</imageState>
+      <creationDate>2014-03-20T15:04:05.000Z</creationDate>
+      <blockDeviceMapping>
+        <item>
+          <deviceName>/dev/sda1</deviceName>
+          <ebs><snapshotId>snap-11111111</snapshotId></ebs>
+        </item>
+      </blockDeviceMapping>
+    </item>
+    <item>
+      <imageId>ami-22222222</imageId>
+      <imageState>available</imageState>
+      <creationDate>2014-04-01T00:00:00.000Z</creationDate>
+    </item>
+    <item>
+      <imageId>ami-33333333</imageId>
+      <imageState>pending</imageState>
+    </item>
+  </imagesSet>
+</DescribeImagesResponse>`
+
+func TestDescribeImageCreationDates(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("Action") != "DescribeImages" || r.PostForm.Get("ImageId.2") != "ami-22222222" {
+			t.Errorf("unexpected request %v", r.PostForm)
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDTEST/") {
+			t.Errorf("authorization %q", r.Header.Get("Authorization"))
+		}
+		fmt.Fprint(w, describeImagesResponse)
+	}))
+	defer srv.Close()
+
+	ec2 := awsec2.New(aws.Auth{AccessKey: "AKIDTEST", SecretKey: "secret"}, aws.Region{Name: "test", EC2Endpoint: srv.URL})
+	dates, err := DescribeImageCreationDates(ec2, []string{"ami-11111111", "ami-22222222", "ami-33333333"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]time.Time{
+		"ami-11111111": time.Date(2014, 3, 20, 15, 4, 5, 0, time.UTC),
+		"ami-22222222": time.Date(2014, 4, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if len(dates) != len(expect) {
+		t.Errorf("dates %v", dates)
+	}
+	for id, date := range expect {
+		if !dates[id].Equal(date) {
+			t.Errorf("%s: %v (expected %v)", id, dates[id], date)
+		}
+	}
+}
+
+func TestEC2QueryError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `<Response><Errors><Error><Code>InvalidAMIID.NotFound</Code><Message>The image id '[ami-00000000]' does not exist</Message></Error></Errors></Response>`)
+	}))
+	defer srv.Close()
+
+	ec2 := awsec2.New(aws.Auth{AccessKey: "AKIDTEST", SecretKey: "secret"}, aws.Region{Name: "test", EC2Endpoint: srv.URL})
+	_, err := DescribeImageCreationDates(ec2, []string{"ami-00000000"})
+	if err == nil || !strings.HasPrefix(err.Error(), "InvalidAMIID.NotFound: ") {
+		t.Errorf("expected InvalidAMIID.NotFound: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// imagecapture.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Capture instances as images
+
+	oti images capture [-r region] [-version v] [-no-reboot] session-id/name/index -name newname
+
+the capture command creates an image from a session instance, e.g. one that
+was adjusted by hand and is worth keeping.  the image is tagged with newname
+(Images.NameTag), the time of capture (Images.BuildDateTag and the oti Created
+tag), the version given by -version (Images.VersionTag), the address of the
+instance (Image.CapturedFrom) and the image the instance was launched from
+(Image.SourceImageId).  oti waits until the image is available so it can be
+launched immediately with `oti launch newname`.
+
+the instance is rebooted while it is captured unless -no-reboot is given, in
+which case the file systems of the image may not be consistent.
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/otiout"
+	"github.com/bmatsuo/oti/otisub"
+	"github.com/bmatsuo/oti/otitag"
+	"github.com/bmatsuo/oti/otiver"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"context"
+	"flag"
+	"fmt"
+	"time"
+)
+
+func ImageCaptureMain(args []string) {
+	fs := otisub.FlagSet(flag.ExitOnError, "images capture", "session-id/name/index -name newname")
+	region := fs.String("r", Config.Ec2.DefaultRegion, "region of the instance")
+	name := fs.String("name", "", "name of the new image (Images.NameTag)")
+	version := fs.String("version", "", "version of the new image (Images.VersionTag)")
+	noReboot := fs.Bool("no-reboot", false, "do not reboot the instance before capturing it")
+	args = parseInterspersed(fs, args)
+	if len(args) != 1 {
+		fs.Usage()
+		Log.Fatal("expected one instance address")
+	}
+	if *name == "" {
+		fs.Usage()
+		Log.Fatal("no image name (-name)")
+	}
+	if *version != "" {
+		if Config.Images.VersionTag == "" {
+			Log.Fatal("no version tag to identify images with")
+		}
+		if _, err := otiver.Parse(*version); err != nil {
+			Log.Fatal(err)
+		}
+	}
+	if Config.Images.NameTag == "" {
+		Log.Fatal("no name tag to identify images with")
+	}
+
+	awsregion, err := Config.AwsRegion(*region)
+	if err != nil {
+		Log.Fatal(err)
+	}
+	ec2, err := NewEC2(awsregion)
+	if err != nil {
+		Log.Fatal("error reading aws credentials: ", err)
+	}
+
+	inst, err := LocateCaptureInstance(ec2, args[0])
+	if err != nil {
+		Log.Fatal(err)
+	}
+
+	ctx, stop := InterruptContext()
+	defer stop()
+
+	img, err := CaptureImage(ctx, ec2, "", inst, *name, *version, *noReboot, time.Now())
+	if err != nil {
+		Log.Fatal(err)
+	}
+
+	out := NewOutput("{{.ImageId}} {{.Name}} {{.State}}")
+	WriteOutput(out, otiout.Record{
+		{Name: "Region", Value: awsregion.Name},
+		{Name: "Name", Value: *name},
+		{Name: "ImageId", Value: img.Id},
+		{Name: "InstanceId", Value: inst.InstanceId},
+		{Name: "CapturedFrom", Value: InstanceAddressOf(inst)},
+		{Name: "SourceImageId", Value: instanceSourceImage(inst)},
+		{Name: "State", Value: img.State},
+	})
+	CloseOutput(out)
+}
+
+// returns the single live instance with the given address.
+func LocateCaptureInstance(ec2 *awsec2.EC2, addr string) (*awsec2.Instance, error) {
+	a, err := ParseInstanceAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	if a.Name == "" || a.Index < 0 {
+		return nil, fmt.Errorf("%s: address one instance (session-id/name/index)", addr)
+	}
+	resvns, err := LocateTargetInstances(ec2, []string{addr}, "", []string{"*"}, []string{"shutting-down", "terminated"})
+	if err != nil {
+		return nil, err
+	}
+	var insts []*awsec2.Instance
+	for i := range resvns {
+		for j := range resvns[i].Instances {
+			insts = append(insts, &resvns[i].Instances[j])
+		}
+	}
+	switch len(insts) {
+	case 0:
+		return nil, fmt.Errorf("%s: no live instance", addr)
+	case 1:
+		return insts[0], nil
+	}
+	return nil, fmt.Errorf("%s: %d instances have the address", addr, len(insts))
+}
+
+// the id of the image inst was launched from.
+func instanceSourceImage(inst *awsec2.Instance) string {
+	if id := instanceTag(inst, Config.Ec2Tag(otitag.IImageId)); id != "" {
+		return id
+	}
+	return inst.ImageId
+}
+
+// create an image named name from inst, tag it and wait until it is
+// available.  ec2 is a client for the given region profile.  version is
+// optional.  the tags are checked before the image is created so a missing
+// tag name does not leave an untagged image behind.
+func CaptureImage(ctx context.Context, ec2 *awsec2.EC2, regionProfile string, inst *awsec2.Instance, name, version string, noReboot bool, t time.Time) (*awsec2.Image, error) {
+	if Config.Images.NameTag == "" {
+		return nil, fmt.Errorf("no name tag to identify images with")
+	}
+	if version != "" && Config.Images.VersionTag == "" {
+		return nil, fmt.Errorf("no version tag to identify images with")
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("interrupted; no image created")
+	}
+	t = t.UTC()
+	addr := InstanceAddressOf(inst)
+	resp, err := ec2.CreateImage(&awsec2.CreateImage{
+		InstanceId: inst.InstanceId,
+		// ami names are unique within a region.
+		Name:        name + "-" + t.Format("20060102T150405Z"),
+		Description: fmt.Sprintf("captured by oti from %s (%s)", addr, inst.InstanceId),
+		NoReboot:    noReboot,
+	})
+	if err != nil {
+		return nil, err
+	}
+	id := resp.ImageId
+	if DEBUG {
+		Log.Printf("capturing %s as %s", inst.InstanceId, id)
+	}
+
+	timestamp := t.Format(time.RFC3339)
+	tags := []awsec2.Tag{
+		{Key: Config.Images.NameTag, Value: name},
+		{Key: Config.Ec2Tag(otitag.Created), Value: timestamp},
+		{Key: Config.Ec2Tag(otitag.MCapturedFrom), Value: addr},
+		{Key: Config.Ec2Tag(otitag.MSourceImageId), Value: instanceSourceImage(inst)},
+	}
+	if Config.Images.BuildDateTag != "" {
+		tags = append(tags, awsec2.Tag{Key: Config.Images.BuildDateTag, Value: timestamp})
+	}
+	if version != "" {
+		tags = append(tags, awsec2.Tag{Key: Config.Images.VersionTag, Value: version})
+	}
+	_, err = ec2.CreateTags([]string{id}, tags)
+	if err != nil {
+		return nil, fmt.Errorf("%s: error tagging image: %v", id, err)
+	}
+
+	return WaitImageAvailable(ctx, ec2, regionProfile, id)
+}
@@ -0,0 +1,34 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"context"
+	"testing"
+	"time"
+)
+
+// missing tag names are reported before an image is created.  a nil client
+// would panic if CreateImage were called.
+func TestCaptureImageTags(t *testing.T) {
+	images := Config.Images
+	defer func() { Config.Images = images }()
+	inst := &awsec2.Instance{InstanceId: "i-1"}
+
+	Config.Images.NameTag = ""
+	_, err := CaptureImage(context.Background(), nil, "", inst, "web", "", false, time.Now())
+	if err == nil {
+		t.Errorf("captured without a name tag")
+	}
+
+	Config.Images.NameTag = "Name"
+	Config.Images.VersionTag = ""
+	_, err = CaptureImage(context.Background(), nil, "", inst, "web", "1.0.0", false, time.Now())
+	if err == nil {
+		t.Errorf("captured a version without a version tag")
+	}
+}
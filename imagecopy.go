@@ -0,0 +1,295 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// imagecopy.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Copy images between regions
+
+	oti images copy [-image id] -from region -to region,... name
+	oti launch -r eu-west-1 -copy-from us-east-1 name
+
+the copy command copies the image `oti launch -r from name` would select (or
+the image given by -image) to each region given by -to, waits for the copies
+to become available and tags them with the name, build date, version and
+release channels of the source image.  copies are tagged with their source (Image.CopiedFrom) and
+a region already holding a copy of the image is skipped, so interrupted copies
+can be retried.  copies that failed or were deregistered are not reused and a
+new copy is started in their place.
+
+when launch is given -copy-from and no image with a manifest's name exists in
+the launch region, the image is copied from the given region before launching.
+because copies carry the channels of their source a copy made for the channel
+directive is selected by later launches instead of being copied again.
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/otiout"
+	"github.com/bmatsuo/oti/otisub"
+	"github.com/bmatsuo/oti/otitag"
+	"github.com/crowdmob/goamz/aws"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func ImageCopyMain(args []string) {
+	fs := otisub.FlagSet(flag.ExitOnError, "images copy", "name")
+	from := fs.String("from", Config.Ec2.DefaultRegion, "region to copy the image from")
+	to := fs.String("to", "", "comma separated regions to copy the image to")
+	imageId := fs.String("image", "", "copy this image instead of the one launch would select")
+	args = parseInterspersed(fs, args)
+	if len(args) != 1 {
+		fs.Usage()
+		Log.Fatal("expected one image name")
+	}
+	name := args[0]
+	if *to == "" {
+		fs.Usage()
+		Log.Fatal("no destination regions (-to)")
+	}
+
+	srcregion, err := Config.AwsRegion(*from)
+	if err != nil {
+		Log.Fatal(err)
+	}
+	var dstregions []aws.Region
+	for _, r := range strings.Split(*to, ",") {
+		dst, err := Config.AwsRegion(r)
+		if err != nil {
+			Log.Fatal(err)
+		}
+		if dst.Name == srcregion.Name {
+			Log.Fatalf("cannot copy %s to its own region", name)
+		}
+		dstregions = append(dstregions, dst)
+	}
+
+	srcec2, err := NewEC2(srcregion)
+	if err != nil {
+		Log.Fatal("error reading aws credentials: ", err)
+	}
+	resolver := &ImageResolver{Name: name}
+	if *imageId != "" {
+		resolver.Strategy, resolver.ImageId = "id", *imageId
+	}
+	src, err := resolver.Lookup(srcec2)
+	if err != nil {
+		Log.Fatalf("%s: %v", name, err)
+	}
+
+	ctx, stop := InterruptContext()
+	defer stop()
+
+	var haserrors bool
+	mut := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	out := NewOutput("{{.Region}}\t{{.ImageId}}\t{{.State}}")
+	for _, dst := range dstregions {
+		dst := dst
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			img, err := copyImageToRegion(ctx, src, srcregion, dst)
+			mut.Lock()
+			defer mut.Unlock()
+			if err != nil {
+				haserrors = true
+				Log.Printf("%s: %v", dst.Name, err)
+				return
+			}
+			WriteOutput(out, otiout.Record{
+				{Name: "Region", Value: dst.Name},
+				{Name: "Name", Value: name},
+				{Name: "ImageId", Value: img.Id},
+				{Name: "SourceRegion", Value: srcregion.Name},
+				{Name: "SourceImageId", Value: src.Id},
+				{Name: "State", Value: img.State},
+			})
+		}()
+	}
+	wg.Wait()
+	CloseOutput(out)
+
+	if haserrors {
+		Log.Fatal()
+	}
+}
+
+func copyImageToRegion(ctx context.Context, src *awsec2.Image, srcregion, dst aws.Region) (*awsec2.Image, error) {
+	ec2, err := NewEC2(dst)
+	if err != nil {
+		return nil, err
+	}
+	return CopyImage(ctx, ec2, "", src, srcregion)
+}
+
+// the Image.CopiedFrom value of copies of img.
+func copiedFrom(region aws.Region, img *awsec2.Image) string {
+	return region.Name + "/" + img.Id
+}
+
+// copy src from srcregion to the region of ec2, a client for the given region
+// profile, tag the copy and wait for it to become available.  an existing copy
+// is reused.
+func CopyImage(ctx context.Context, ec2 *awsec2.EC2, regionProfile string, src *awsec2.Image, srcregion aws.Region) (*awsec2.Image, error) {
+	copytag := Config.Ec2Tag(otitag.MCopiedFrom)
+	filter := awsec2.NewFilter()
+	filter.Add("tag:"+copytag, copiedFrom(srcregion, src))
+	resp, err := ec2.Images(nil, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var id string
+	var dead []string
+	for _, img := range resp.Images {
+		if img.State == "failed" || img.State == "deregistered" {
+			dead = append(dead, img.Id)
+			continue
+		}
+		id = img.Id
+		if DEBUG {
+			Log.Printf("%s: reusing copy %s of %s", ec2.Region.Name, id, src.Id)
+		}
+		break
+	}
+	if id == "" {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("interrupted; image not copied")
+		}
+		// ec2 answers a repeated client token with the image of the first
+		// copy, so copies that cannot be reused are excluded by naming them in
+		// the token.
+		parts := append([]string{src.Id, ec2.Region.Name}, dead...)
+		id, err = startImageCopy(ec2, src, srcregion, copyToken(parts...))
+		if err == nil && !copyUsable(ec2, id) {
+			// the token started a copy that has since been removed (e.g. by
+			// images prune).
+			parts = append(parts, strconv.FormatInt(time.Now().UnixNano(), 36))
+			id, err = startImageCopy(ec2, src, srcregion, copyToken(parts...))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the copy is tagged immediately so an interrupted copy can be found.
+	// launch does not select images until they are available.
+	tags := []awsec2.Tag{{Key: copytag, Value: copiedFrom(srcregion, src)}}
+	for _, key := range []string{
+		Config.Images.NameTag,
+		Config.Images.BuildDateTag,
+		Config.Images.VersionTag,
+		Config.Images.ChannelTag,
+		Config.Ec2Tag(otitag.Created),
+	} {
+		if v := imageTag(src, key); key != "" && v != "" {
+			tags = append(tags, awsec2.Tag{Key: key, Value: v})
+		}
+	}
+	_, err = ec2.CreateTags([]string{id}, tags)
+	if err != nil {
+		return nil, fmt.Errorf("%s: error tagging image: %v", id, err)
+	}
+
+	return WaitImageAvailable(ctx, ec2, regionProfile, id)
+}
+
+func startImageCopy(ec2 *awsec2.EC2, src *awsec2.Image, srcregion aws.Region, token string) (string, error) {
+	resp, err := ec2.CopyImage(&awsec2.CopyImage{
+		SourceRegion:  srcregion.Name,
+		SourceImageId: src.Id,
+		Name:          src.Name,
+		Description:   src.Description,
+		ClientToken:   token,
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.ImageId, nil
+}
+
+// a client token for CopyImage identified by parts.  tokens are limited to 64
+// characters so the parts are hashed.
+func copyToken(parts ...string) string {
+	h := sha1.Sum([]byte(strings.Join(parts, "/")))
+	return "oti-copy-" + hex.EncodeToString(h[:])
+}
+
+// false if the copy id has failed or no longer exists.
+func copyUsable(ec2 *awsec2.EC2, id string) bool {
+	img, err := LookupImageId(ec2, id)
+	if err != nil {
+		return false
+	}
+	return img.State != "failed" && img.State != "deregistered"
+}
+
+// wait until the image id is available.  ec2 is a client for the given region
+// profile and its credentials are refreshed while waiting.  an error is
+// returned if the image fails or ctx is canceled.
+func WaitImageAvailable(ctx context.Context, ec2 *awsec2.EC2, regionProfile, id string) (*awsec2.Image, error) {
+	for {
+		err := RefreshEC2(ec2, regionProfile)
+		if err != nil {
+			return nil, err
+		}
+		img, err := LookupImageId(ec2, id)
+		if err != nil {
+			return nil, err
+		}
+		switch img.State {
+		case "available":
+			return img, nil
+		case "failed", "deregistered", "invalid", "error":
+			return nil, fmt.Errorf("image %s %s: %s", id, img.State, img.StateReason)
+		}
+		if DEBUG {
+			Log.Printf("waiting for image %s (%s)", id, img.State)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("interrupted while waiting for image %s", id)
+		case <-time.After(WaitInterval):
+		}
+	}
+}
+
+// locate the image selected by r in the region of ec2, a client for the given
+// region profile.  if there are no images with the name it is copied from the
+// image r selects in srcregion.
+func LookupOrCopyImage(ctx context.Context, ec2 *awsec2.EC2, regionProfile string, r *ImageResolver, srcregion aws.Region) (*awsec2.Image, error) {
+	images, err := LookupImages(ec2, r.Name, r.Channel)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) > 0 {
+		image, _, err := r.Resolve(ec2, images)
+		return image, err
+	}
+
+	srcec2, err := NewEC2(srcregion)
+	if err != nil {
+		return nil, err
+	}
+	src, err := r.Lookup(srcec2)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", srcregion.Name, err)
+	}
+	Log.Printf("%s: copying image %s from %s", r.Name, src.Id, srcregion.Name)
+	return CopyImage(ctx, ec2, regionProfile, src, srcregion)
+}
@@ -0,0 +1,203 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// imagepromote.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Promote images
+
+images move through release channels (e.g. dev, staging, stable) without
+changing launch commands.
+
+	oti images promote [-r region] name image-id channel
+	oti launch name channel=stable
+
+the channels of an image are listed in its Images.ChannelTag tag.  promoting
+an image adds the channel to the image and removes it from any other image
+with the same name in the region, so each channel names at most one image.
+the changes are recorded, newest first, in the Image.Promotions tag of each
+image affected ("stable@<time>" when added, "-stable@<time>" when removed).
+tag values are limited so the oldest changes are eventually dropped.
+
+the channel directive of `oti launch` only considers images in the channel.
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/otiout"
+	"github.com/bmatsuo/oti/otisub"
+	"github.com/bmatsuo/oti/otitag"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// the maximum length of an ec2 tag value
+const MaxTagValueLength = 255
+
+func ImagePromoteMain(args []string) {
+	fs := otisub.FlagSet(flag.ExitOnError, "images promote", "name image-id channel")
+	region := fs.String("r", Config.Ec2.DefaultRegion, "region of the image")
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) != 3 {
+		fs.Usage()
+		Log.Fatal("expected a name, an image id and a channel")
+	}
+	name, imageId, channel := args[0], args[1], args[2]
+
+	awsregion, err := Config.AwsRegion(*region)
+	if err != nil {
+		Log.Fatal(err)
+	}
+	ec2, err := NewEC2(awsregion)
+	if err != nil {
+		Log.Fatal("error reading aws credentials: ", err)
+	}
+
+	demoted, err := PromoteImage(ec2, name, imageId, channel, time.Now())
+	if err != nil {
+		Log.Fatal(err)
+	}
+
+	out := NewOutput("{{.ImageId}} {{.Channel}}{{if .Demoted}} (was {{.Demoted}}){{end}}")
+	WriteOutput(out, otiout.Record{
+		{Name: "Region", Value: awsregion.Name},
+		{Name: "Name", Value: name},
+		{Name: "ImageId", Value: imageId},
+		{Name: "Channel", Value: channel},
+		{Name: "Demoted", Value: strings.Join(demoted, ",")},
+	})
+	CloseOutput(out)
+}
+
+// add channel to the image with id imageId, which must have the given name,
+// and remove it from other images with the name.  the ids of images removed
+// from the channel are returned.
+func PromoteImage(ec2 *awsec2.EC2, name, imageId, channel string, t time.Time) ([]string, error) {
+	if Config.Images.ChannelTag == "" {
+		return nil, fmt.Errorf("no channel tag to promote images with")
+	}
+	if err := validChannel(channel); err != nil {
+		return nil, err
+	}
+	images, err := LookupImages(ec2, name, "")
+	if err != nil {
+		return nil, err
+	}
+	var image *awsec2.Image
+	for i := range images {
+		if images[i].Id == imageId {
+			image = &images[i]
+		}
+	}
+	if image == nil {
+		return nil, fmt.Errorf("image %s is not named %q", imageId, name)
+	}
+
+	// the image is promoted before others are demoted so the channel never
+	// lacks an image.
+	channels := ImageChannels(image)
+	if !containsString(channels, channel) {
+		channels = append(channels, channel)
+		err := setImageChannels(ec2, image, channels, channel+"@"+t.UTC().Format(time.RFC3339))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", image.Id, err)
+		}
+	}
+
+	var demoted []string
+	for i := range images {
+		img := &images[i]
+		if img.Id == imageId {
+			continue
+		}
+		channels := ImageChannels(img)
+		if !containsString(channels, channel) {
+			continue
+		}
+		var rest []string
+		for _, c := range channels {
+			if c != channel {
+				rest = append(rest, c)
+			}
+		}
+		err := setImageChannels(ec2, img, rest, "-"+channel+"@"+t.UTC().Format(time.RFC3339))
+		if err != nil {
+			return demoted, fmt.Errorf("%s: %v", img.Id, err)
+		}
+		demoted = append(demoted, img.Id)
+	}
+	return demoted, nil
+}
+
+// returns the release channels of img.  see Config.Images.ChannelTag.
+func ImageChannels(img *awsec2.Image) []string {
+	if Config.Images.ChannelTag == "" {
+		return nil
+	}
+	var channels []string
+	for _, c := range strings.Split(imageTag(img, Config.Images.ChannelTag), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			channels = append(channels, c)
+		}
+	}
+	return channels
+}
+
+// true if img is in channel.
+func ImageInChannel(img *awsec2.Image, channel string) bool {
+	return containsString(ImageChannels(img), channel)
+}
+
+func validChannel(channel string) error {
+	if channel == "" || strings.ContainsAny(channel, ", @") {
+		return fmt.Errorf("invalid channel %q", channel)
+	}
+	return nil
+}
+
+// set the channel tag of img and prepend change to its promotion history.
+func setImageChannels(ec2 *awsec2.EC2, img *awsec2.Image, channels []string, change string) error {
+	history := change
+	if prev := imageTag(img, Config.Ec2Tag(otitag.MPromotions)); prev != "" {
+		history += " " + prev
+	}
+	for len(history) > MaxTagValueLength {
+		i := strings.LastIndex(history, " ")
+		if i < 0 {
+			history = history[:MaxTagValueLength]
+			break
+		}
+		history = history[:i]
+	}
+	tags := []awsec2.Tag{{Key: Config.Ec2Tag(otitag.MPromotions), Value: history}}
+	if len(channels) > 0 {
+		tags = append(tags, awsec2.Tag{Key: Config.Images.ChannelTag, Value: strings.Join(channels, ",")})
+	} else {
+		_, err := ec2.DeleteTags([]string{img.Id}, []awsec2.Tag{{
+			Key:   Config.Images.ChannelTag,
+			Value: imageTag(img, Config.Images.ChannelTag),
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := ec2.CreateTags([]string{img.Id}, tags)
+	return err
+}
+
+func containsString(ss []string, s string) bool {
+	for _, _s := range ss {
+		if _s == s {
+			return true
+		}
+	}
+	return false
+}
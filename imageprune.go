@@ -0,0 +1,213 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// imageprune.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Prune images
+
+	oti images prune [-r region] [-keep N] [-lock oti.lock,...] [-n] name ...
+
+the prune command deregisters old images of each name and deletes the EBS
+snapshots backing them.  images are ordered as `oti launch` selects them (see
+resolve.go) and the first N (-keep, default 3) are kept.  images that cannot
+be ordered, images in a release channel, images used by live instances (see
+the Instance.ImageId tag) and images pinned by any of the lockfiles given with
+-lock are never removed.
+
+with -n nothing is removed and oti prints what would be done.  records have
+the fields Region, Name, ImageId, Action ("keep" or "prune"), Reason and
+Snapshots.
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/otiout"
+	"github.com/bmatsuo/oti/otisub"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"flag"
+	"fmt"
+	"strings"
+)
+
+func ImagePruneMain(args []string) {
+	fs := otisub.FlagSet(flag.ExitOnError, "images prune", "name ...")
+	region := fs.String("r", Config.Ec2.DefaultRegion, "region of the images")
+	keep := fs.Int("keep", 3, "number of images of each name to keep")
+	locks := fs.String("lock", DefaultLockPath, "comma separated lockfiles whose images are kept")
+	dryrun := fs.Bool("n", false, "print what would be removed without removing anything")
+	names := parseInterspersed(fs, args)
+	if len(names) == 0 {
+		fs.Usage()
+		Log.Fatal("no image names given")
+	}
+	if *keep < 0 {
+		Log.Fatal("-keep cannot be negative")
+	}
+
+	awsregion, err := Config.AwsRegion(*region)
+	if err != nil {
+		Log.Fatal(err)
+	}
+	ec2, err := NewEC2(awsregion)
+	if err != nil {
+		Log.Fatal("error reading aws credentials: ", err)
+	}
+
+	pinned := make(map[string]string)
+	for _, path := range strings.Split(*locks, ",") {
+		if path == "" {
+			continue
+		}
+		lock, err := ReadImageLock(path)
+		if err != nil {
+			Log.Fatal(err)
+		}
+		for _, regions := range lock.Images {
+			for _, img := range regions {
+				pinned[img.ImageId] = path
+			}
+		}
+	}
+	usage, err := LocateImageUsage(ec2)
+	if err != nil {
+		Log.Fatal("error locating instances: ", err)
+	}
+
+	var haserrors bool
+	out := NewOutput("{{.Action}}\t{{.Name}}\t{{.ImageId}}\t{{.Reason}}")
+	for _, name := range names {
+		plan, err := PlanImagePrune(ec2, name, *keep, usage, pinned)
+		if err != nil {
+			Log.Fatalf("%s: %v", name, err)
+		}
+		for _, p := range plan {
+			if p.Prune && !*dryrun {
+				err := PruneImage(ec2, p.Image)
+				if err != nil {
+					haserrors = true
+					Log.Printf("%s: %s: %v", name, p.Image.Id, err)
+					continue
+				}
+			}
+			action := "keep"
+			if p.Prune {
+				action = "prune"
+			}
+			WriteOutput(out, otiout.Record{
+				{Name: "Region", Value: awsregion.Name},
+				{Name: "Name", Value: name},
+				{Name: "ImageId", Value: p.Image.Id},
+				{Name: "Action", Value: action},
+				{Name: "Reason", Value: p.Reason},
+				{Name: "Snapshots", Value: ImageSnapshotIds(p.Image)},
+			})
+		}
+	}
+	CloseOutput(out)
+
+	if haserrors {
+		Log.Fatal()
+	}
+}
+
+// whether an image is removed by `oti images prune` and why.
+type ImagePrunePlan struct {
+	Image  *awsec2.Image
+	Prune  bool
+	Reason string
+}
+
+// decides which images named name are pruned, keeping the first keep images
+// launch would select.  usage is the result of LocateImageUsage and pinned
+// maps locked image ids to their lockfile.
+func PlanImagePrune(ec2 *awsec2.EC2, name string, keep int, usage map[string]ImageUsage, pinned map[string]string) ([]ImagePrunePlan, error) {
+	images, err := LookupImages(ec2, name, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images named %q", name)
+	}
+	resolver := &ImageResolver{Name: name}
+	// images are kept when none can be ordered.
+	_, candidates, err := resolver.Resolve(ec2, images)
+	if candidates == nil {
+		return nil, err
+	}
+
+	var plan []ImagePrunePlan
+	var kept int
+	for _, c := range candidates {
+		p := ImagePrunePlan{Image: c.Image}
+		switch u, locked := usage[c.Image.Id], pinned[c.Image.Id]; {
+		case c.Err != nil:
+			p.Reason = fmt.Sprintf("cannot be ordered: %v", c.Err)
+		case kept < keep:
+			kept++
+			p.Reason = fmt.Sprintf("among the %d latest", keep)
+		case u.Instances > 0:
+			p.Reason = fmt.Sprintf("used by %d instances", u.Instances)
+		case locked != "":
+			p.Reason = "locked in " + locked
+		case len(ImageChannels(c.Image)) > 0:
+			p.Reason = "in channels " + strings.Join(ImageChannels(c.Image), ",")
+		default:
+			p.Prune = true
+			p.Reason = "old"
+		}
+		plan = append(plan, p)
+	}
+	return plan, nil
+}
+
+// deregister img and delete its snapshots.  snapshots can only be deleted
+// once the image is deregistered.
+func PruneImage(ec2 *awsec2.EC2, img *awsec2.Image) error {
+	_, err := ec2.DeregisterImage(img.Id)
+	if err != nil {
+		return err
+	}
+	snapshots := ImageSnapshotIds(img)
+	if len(snapshots) == 0 {
+		return nil
+	}
+	_, err = ec2.DeleteSnapshots(snapshots)
+	if err != nil {
+		return fmt.Errorf("deregistered but snapshots %v remain: %v", snapshots, err)
+	}
+	return nil
+}
+
+// the ids of the EBS snapshots backing img.
+func ImageSnapshotIds(img *awsec2.Image) []string {
+	var ids []string
+	for _, bd := range img.BlockDevices {
+		if bd.SnapshotId != "" {
+			ids = append(ids, bd.SnapshotId)
+		}
+	}
+	return ids
+}
+
+// parse fs allowing flags to follow positional arguments (e.g. "name -keep
+// 2").  the positional arguments are returned.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...)
+		}
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
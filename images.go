@@ -0,0 +1,260 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// images.go [created: Mon, 19 Oct 2026]
+
+/*
+
+List images
+
+the "images" command lists the images oti can launch.
+
+	oti images [-r region] [name]
+
+images are located by the Images.NameTag config option.  when name is given
+only images with that name are listed.  every region is searched unless -r is
+given.  for each image oti prints the region, name, image id, build date
+(Images.BuildDateTag), version (Images.VersionTag), release channels
+(Images.ChannelTag), state and the number of live instances launched from the
+image (see the Instance.ImageId tag).  the image `oti launch name` would
+select in each region is marked with '*'.
+
+records have the fields Region, Name, ImageId, BuildDate, Version, Channels,
+State, InUse, Sessions and Selected.
+
+other image commands are named by the first argument (see ImageCommands).
+
+	oti images promote [-r region] name image-id channel
+	oti images update-lock [-lock oti.lock] [-r region] [name ...]
+	oti images prune [-r region] [-keep N] [-n] name ...
+	oti images copy -from region -to region,... name
+	oti images share|unshare [-r region] [-accounts a,b] name
+	oti images capture [-r region] session-id/name/index -name newname
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/otiout"
+	"github.com/bmatsuo/oti/otisub"
+	"github.com/bmatsuo/oti/otitag"
+	"github.com/crowdmob/goamz/aws"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// image commands other than listing, by name.  the name of an image cannot be
+// listed if it is the name of a command.
+var ImageCommands = map[string]func(args []string){
+	"promote":     ImagePromoteMain,
+	"update-lock": ImageUpdateLockMain,
+	"prune":       ImagePruneMain,
+	"copy":        ImageCopyMain,
+	"share":       ImageShareMain,
+	"unshare":     ImageUnshareMain,
+	"capture":     ImageCaptureMain,
+}
+
+var images = otisub.Register("images", func(args []string) {
+	if len(args) > 0 {
+		if cmd := ImageCommands[args[0]]; cmd != nil {
+			cmd(args[1:])
+			return
+		}
+	}
+
+	fs := otisub.FlagSet(flag.ExitOnError, "images", "[name]")
+	region := fs.String("r", "", "only list images in this region")
+	fs.Parse(args)
+	args = fs.Args()
+
+	var name string
+	switch len(args) {
+	case 0:
+	case 1:
+		name = args[0]
+	default:
+		fs.Usage()
+		Log.Fatal("too many arguments")
+	}
+
+	regions := Ec2Regions(false)
+	if *region != "" {
+		r, err := Config.AwsRegion(*region)
+		if err != nil {
+			Log.Fatal(err)
+		}
+		regions = []aws.Region{r}
+	}
+
+	var rs []otiout.Record
+	var haserrors bool
+	mut := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for _, r := range regions {
+		r := r
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_rs, err := RegionImageRecords(r, name)
+			mut.Lock()
+			defer mut.Unlock()
+			if err != nil {
+				haserrors = true
+				Log.Printf("%s: %v", r.Name, err)
+				return
+			}
+			rs = append(rs, _rs...)
+		}()
+	}
+	wg.Wait()
+
+	// regions are listed in a stable order.  images of each region are
+	// already ordered.
+	sort.SliceStable(rs, func(i, j int) bool {
+		return fmt.Sprint(rs[i].Get("Region")) < fmt.Sprint(rs[j].Get("Region"))
+	})
+
+	out := NewOutput("{{.Region}}\t{{.Name}}\t{{.ImageId}}\t{{.BuildDate}}\t{{.Version}}\t{{.Channels}}\t{{.State}}\t{{.InUse}}{{if .Selected}}\t*{{end}}")
+	for _, r := range rs {
+		WriteOutput(out, r)
+	}
+	CloseOutput(out)
+
+	if haserrors {
+		Log.Fatal()
+	}
+})
+
+// returns records describing the images in region with the given name (or all
+// names if name is empty), ordered by name and build date.
+func RegionImageRecords(region aws.Region, name string) ([]otiout.Record, error) {
+	ec2, err := NewEC2(region)
+	if err != nil {
+		return nil, err
+	}
+	imgs, err := LookupTaggedImages(ec2, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(imgs) == 0 {
+		return nil, nil
+	}
+	usage, err := LocateImageUsage(ec2)
+	if err != nil {
+		return nil, err
+	}
+
+	nametag := Config.Images.NameTag
+	byname := make(map[string][]awsec2.Image)
+	var names []string
+	for _, img := range imgs {
+		n := imageTag(&img, nametag)
+		if byname[n] == nil {
+			names = append(names, n)
+		}
+		byname[n] = append(byname[n], img)
+	}
+	sort.Strings(names)
+
+	var rs []otiout.Record
+	for _, n := range names {
+		group := byname[n]
+		var selected string
+		resolver := &ImageResolver{Name: n}
+		if img, _, err := resolver.Resolve(ec2, group); err == nil {
+			selected = img.Id
+		}
+		sort.SliceStable(group, func(i, j int) bool {
+			ti, _ := imageBuildDate(&group[i])
+			tj, _ := imageBuildDate(&group[j])
+			return ti.After(tj)
+		})
+		for i := range group {
+			img := &group[i]
+			u := usage[img.Id]
+			rs = append(rs, otiout.Record{
+				{Name: "Region", Value: region.Name},
+				{Name: "Name", Value: n},
+				{Name: "ImageId", Value: img.Id},
+				{Name: "BuildDate", Value: imageTag(img, Config.Images.BuildDateTag)},
+				{Name: "Version", Value: imageTag(img, Config.Images.VersionTag)},
+				{Name: "Channels", Value: strings.Join(ImageChannels(img), ",")},
+				{Name: "State", Value: img.State},
+				{Name: "InUse", Value: u.Instances},
+				{Name: "Sessions", Value: u.Sessions},
+				{Name: "Selected", Value: img.Id == selected},
+			})
+		}
+	}
+	return rs, nil
+}
+
+// images tagged with Config.Images.NameTag.  if name is not empty only images
+// with that name are returned.
+func LookupTaggedImages(ec2 *awsec2.EC2, name string) ([]awsec2.Image, error) {
+	if name != "" {
+		return LookupImages(ec2, name, "")
+	}
+	nametag := Config.Images.NameTag
+	if nametag == "" {
+		return nil, fmt.Errorf("no name tag to identify images")
+	}
+	filter := awsec2.NewFilter()
+	filter.Add("tag-key", nametag)
+	resp, err := ec2.Images(nil, filter)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Images, nil
+}
+
+// the live oti instances launched from an image.
+type ImageUsage struct {
+	Instances int
+	Sessions  []SessionId
+}
+
+// returns the usage of each image by live oti instances, keyed by image id.
+// instances are attributed to the image in their Instance.ImageId tag.
+// instances launched before the tag existed are attributed to their ImageId.
+func LocateImageUsage(ec2 *awsec2.EC2) (map[string]ImageUsage, error) {
+	sessionidtag := Config.Ec2Tag(otitag.SessionId)
+	imageidtag := Config.Ec2Tag(otitag.IImageId)
+	filter := awsec2.NewFilter()
+	filter.Add("tag-key", sessionidtag)
+	filter.Add("instance-state-name", "pending", "running", "stopping", "stopped")
+	resp, err := ec2.DescribeInstances(nil, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]ImageUsage)
+	for _, resvn := range resp.Reservations {
+		for i := range resvn.Instances {
+			inst := &resvn.Instances[i]
+			id := instanceTag(inst, imageidtag)
+			if id == "" {
+				id = inst.ImageId
+			}
+			u := usage[id]
+			u.Instances++
+			sid := SessionId(instanceTag(inst, sessionidtag))
+			found := false
+			for _, s := range u.Sessions {
+				found = found || s == sid
+			}
+			if !found {
+				u.Sessions = append(u.Sessions, sid)
+			}
+			usage[id] = u
+		}
+	}
+	return usage, nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// imageshare.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Share images with other accounts
+
+	oti images share [-r region] [-accounts a,b] [-image id|-version c|-channel ch|-all] name
+	oti images unshare [-r region] [-accounts a,b] [-image id|-version c|-channel ch|-all] name
+
+the share command grants other aws accounts permission to launch images and
+to create volumes from the snapshots backing them.  unshare revokes the
+permissions.  accounts are account ids or the names of lists in the
+Images.AccountLists config option.  without -accounts the accounts in
+Images.ShareAccounts are used.
+
+by default the image `oti launch name` would select is shared.  -version and
+-channel select the image as the launch directives do, -image names an image
+and -all shares every image with the name.  the id of each shared image is
+written to the output.
+
+tags are not visible to other accounts, so launch in an account an image was
+shared with cannot select it by name, version or channel.  the other accounts
+launch a shared image by id with the "ami" directive.
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/otiout"
+	"github.com/bmatsuo/oti/otisub"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func ImageShareMain(args []string) {
+	imageShareMain("share", args)
+}
+
+func ImageUnshareMain(args []string) {
+	imageShareMain("unshare", args)
+}
+
+func imageShareMain(cmd string, args []string) {
+	fs := otisub.FlagSet(flag.ExitOnError, "images "+cmd, "name")
+	region := fs.String("r", Config.Ec2.DefaultRegion, "region of the images")
+	accounts := fs.String("accounts", "", "comma separated account ids or account lists (default Images.ShareAccounts)")
+	imageId := fs.String("image", "", "the image to "+cmd)
+	version := fs.String("version", "", "a version constraint selecting the image")
+	channel := fs.String("channel", "", "a release channel selecting the image")
+	all := fs.Bool("all", false, cmd+" every image with the name")
+	args = parseInterspersed(fs, args)
+	if len(args) != 1 {
+		fs.Usage()
+		Log.Fatal("expected one image name")
+	}
+	name := args[0]
+
+	var names []string
+	if *accounts != "" {
+		names = strings.Split(*accounts, ",")
+	}
+	ids, err := Config.ShareAccounts(names)
+	if err != nil {
+		Log.Fatal(err)
+	}
+
+	awsregion, err := Config.AwsRegion(*region)
+	if err != nil {
+		Log.Fatal(err)
+	}
+	ec2, err := NewEC2(awsregion)
+	if err != nil {
+		Log.Fatal("error reading aws credentials: ", err)
+	}
+
+	var images []awsec2.Image
+	if *all {
+		if *imageId != "" || *version != "" {
+			Log.Fatal("-all cannot be given with -image or -version")
+		}
+		images, err = LookupImages(ec2, name, *channel)
+		if err == nil && len(images) == 0 {
+			err = fmt.Errorf("no images named %q", name)
+		}
+	} else {
+		if *imageId != "" && *version != "" {
+			Log.Fatal("-image cannot be given with -version")
+		}
+		resolver := &ImageResolver{Name: name, Version: *version, Channel: *channel}
+		if *imageId != "" {
+			resolver.Strategy, resolver.ImageId = "id", *imageId
+		}
+		var img *awsec2.Image
+		img, err = resolver.Lookup(ec2)
+		if err == nil {
+			images = append(images, *img)
+		}
+	}
+	if err != nil {
+		Log.Fatalf("%s: %v", name, err)
+	}
+
+	var haserrors bool
+	out := NewOutput("{{.ImageId}}\t{{.Action}}\t{{.Accounts}}")
+	for i := range images {
+		img := &images[i]
+		err := ShareImage(ec2, img, ids, cmd == "share")
+		if err != nil {
+			haserrors = true
+			Log.Printf("%s: %v", img.Id, err)
+			continue
+		}
+		WriteOutput(out, otiout.Record{
+			{Name: "Region", Value: awsregion.Name},
+			{Name: "Name", Value: name},
+			{Name: "ImageId", Value: img.Id},
+			{Name: "Action", Value: cmd},
+			{Name: "Accounts", Value: ids},
+			{Name: "Snapshots", Value: ImageSnapshotIds(img)},
+		})
+	}
+	CloseOutput(out)
+
+	if haserrors {
+		Log.Fatal()
+	}
+}
+
+// grant (or revoke, if share is false) accounts permission to launch img and
+// to create volumes from its snapshots.
+func ShareImage(ec2 *awsec2.EC2, img *awsec2.Image, accounts []string, share bool) error {
+	attr := &awsec2.ModifyImageAttribute{}
+	if share {
+		attr.AddUsers = accounts
+	} else {
+		attr.RemoveUsers = accounts
+	}
+	_, err := ec2.ModifyImageAttribute(img.Id, attr)
+	if err != nil {
+		return fmt.Errorf("launch permission: %v", err)
+	}
+	for _, snap := range ImageSnapshotIds(img) {
+		err := ModifySnapshotVolumePermission(ec2, snap, accounts, share)
+		if err != nil {
+			return fmt.Errorf("snapshot %s: %v", snap, err)
+		}
+	}
+	return nil
+}
+
+// grant (or revoke) accounts permission to create volumes from a snapshot.
+// goamz does not implement ModifySnapshotAttribute.  see EC2Query.
+func ModifySnapshotVolumePermission(ec2 *awsec2.EC2, snapshotId string, accounts []string, add bool) error {
+	op := "Remove"
+	if add {
+		op = "Add"
+	}
+	form := url.Values{}
+	form.Set("Action", "ModifySnapshotAttribute")
+	form.Set("SnapshotId", snapshotId)
+	for i, id := range accounts {
+		form.Set("CreateVolumePermission."+op+"."+strconv.Itoa(i+1)+".UserId", id)
+	}
+	_, err := EC2Query(ec2, form)
+	return err
+}
@@ -8,88 +8,329 @@
 
 Inspect session instances
 
-BUG this command does nothing
+the "instances" command lists the instances belonging to a session.
 
-run a session through its full lifecycle from launch to termination.
+	oti instances [-columns col,...] [-sort [-]col] session-id[/name[/index]]
 
-	oti instances session-id
+by default the region, instance id, state and public dns name of each instance
+are listed.  the -columns option (or the Instances.Columns config option)
+selects other columns.  the available columns are
+
+	SessionId, Manifest, Index, Address, Region, InstanceId, State, DNSName,
+	PrivateDNSName, IPAddress, PrivateIPAddress, AvailabilityZone,
+	InstanceType, ImageId, KeyName, LaunchTime, Age, Tags, tag:key
+
+where tag:key is the value of the tag named key (e.g. "tag:Name").  column
+names are not case sensitive.  the -sort option (or Instances.SortBy) orders
+instances by a column; prefixing the column with "-" reverses the order.
+
+the columns select what is printed by text templates and tables.  with -o json,
+jsonl or csv every field of the instance record (see InstanceRecord) is
+written, followed by the selected columns it does not include.
 
 */
 package main
 
 import (
+	"github.com/bmatsuo/oti/otiout"
 	"github.com/bmatsuo/oti/otisub"
 	"github.com/bmatsuo/oti/otitag"
 	"github.com/crowdmob/goamz/aws"
 	awsec2 "github.com/crowdmob/goamz/ec2"
 
+	"encoding/json"
 	"flag"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 var instances = otisub.Register("instances", func(args []string) {
 	fs := otisub.FlagSet(flag.ExitOnError, "instances", "session-id")
+	columns := fs.String("columns", strings.Join(Config.Instances.Columns, ","), "comma separated columns to list")
+	sortby := fs.String("sort", Config.Instances.SortBy, "column to sort instances by")
 	fs.Parse(args)
 	args = fs.Args()
 	if len(args) != 1 {
 		Log.Fatal("missing argument")
 	}
 
-	session := SessionId(args[0])
-	// TODO validate session
+	addr, err := ParseInstanceAddress(args[0])
+	if err != nil {
+		Log.Fatal(err)
+	}
 
-	awsauth, err := Config.AwsAuth()
+	var cols []string
+	if *columns != "" {
+		cols = strings.Split(*columns, ",")
+	}
+	cols, err = InstanceColumnNames(cols)
 	if err != nil {
-		Log.Fatalln("error reading aws credentials: ", err)
+		Log.Fatal(err)
+	}
+	sortcol, sortdesc := strings.TrimPrefix(*sortby, "-"), strings.HasPrefix(*sortby, "-")
+	if sortcol != "" {
+		sortcols, err := InstanceColumnNames([]string{sortcol})
+		if err != nil {
+			Log.Fatal("invalid sort column: ", err)
+		}
+		sortcol = sortcols[0]
 	}
 
-	sisch := make(chan SessionInstances, len(aws.Regions))
-	go DescribeSessionInstances(awsauth, session, sisch)
+	now := time.Now()
+	var rs []otiout.Record
+	sisch := make(chan SessionInstances, len(Ec2Regions(false)))
+	go DescribeSessionInstances(addr, sisch)
 	for sis := range sisch {
+		if sis.Err != nil {
+			Log.Fatalf("%s: %v", sis.Region.Name, sis.Err)
+		}
 		for _, resn := range sis.Reservations {
-			for _, inst := range resn.Instances {
-				cols := []string{
-					sis.Region.Name,
-					inst.InstanceId,
-					inst.State.Name,
-					inst.DNSName,
+			for i := range resn.Instances {
+				inst := &resn.Instances[i]
+				r := InstanceRecord(sis.Region.Name, inst)
+				for _, col := range cols {
+					r = r.Set(col, InstanceColumn(col, sis.Region.Name, inst, now))
+				}
+				if sortcol != "" {
+					r = r.Set(sortcol, InstanceColumn(sortcol, sis.Region.Name, inst, now))
 				}
-				fmt.Println(strings.Join(cols, "\t"))
+				rs = append(rs, r)
 			}
 		}
 	}
+
+	if sortcol != "" {
+		SortRecords(rs, sortcol, sortdesc)
+	}
+
+	out := NewOutput(ColumnTemplate(cols))
+	for _, r := range rs {
+		if StructuredOutput() {
+			WriteOutput(out, r)
+		} else {
+			WriteOutput(out, selectFields(r, cols))
+		}
+	}
+	CloseOutput(out)
 })
 
-// closes sisch on return
-func DescribeSessionInstances(auth aws.Auth, session SessionId, sisch chan<- SessionInstances) {
+// the default columns of the instances command
+var DefaultInstanceColumns = []string{"Region", "InstanceId", "State", "DNSName"}
+
+// columns of the instances command other than "tag:key" columns.
+var InstanceColumns = []string{
+	"SessionId",
+	"Manifest",
+	"Index",
+	"Address",
+	"Region",
+	"InstanceId",
+	"State",
+	"DNSName",
+	"PrivateDNSName",
+	"IPAddress",
+	"PrivateIPAddress",
+	"AvailabilityZone",
+	"InstanceType",
+	"ImageId",
+	"KeyName",
+	"LaunchTime",
+	"Age",
+	"Tags",
+}
+
+// returns the canonical names of the given columns or an error if a column
+// is unknown.  if no columns are given DefaultInstanceColumns are returned.
+func InstanceColumnNames(cols []string) ([]string, error) {
+	if len(cols) == 0 {
+		return DefaultInstanceColumns, nil
+	}
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		col = strings.TrimSpace(col)
+		if strings.HasPrefix(strings.ToLower(col), "tag:") && len(col) > len("tag:") {
+			names[i] = "tag:" + col[len("tag:"):]
+			continue
+		}
+		for _, name := range InstanceColumns {
+			if strings.EqualFold(col, name) {
+				names[i] = name
+				break
+			}
+		}
+		if names[i] == "" {
+			return nil, fmt.Errorf("unknown column %q; columns are %s and tag:key",
+				col, strings.Join(InstanceColumns, ", "))
+		}
+	}
+	return names, nil
+}
+
+// the value of the named column for inst.  col must be a canonical name
+// returned by InstanceColumnNames.
+func InstanceColumn(col string, region string, inst *awsec2.Instance, now time.Time) interface{} {
+	if strings.HasPrefix(col, "tag:") {
+		return instanceTag(inst, col[len("tag:"):])
+	}
+	switch col {
+	case "SessionId":
+		return instanceTag(inst, Config.Ec2Tag(otitag.SessionId))
+	case "Manifest":
+		return instanceTag(inst, Config.Ec2Tag(otitag.IManifest))
+	case "Index":
+		return instanceTag(inst, Config.Ec2Tag(otitag.IIndex))
+	case "Address":
+		return InstanceAddressOf(inst)
+	case "Region":
+		return region
+	case "InstanceId":
+		return inst.InstanceId
+	case "State":
+		return inst.State.Name
+	case "DNSName":
+		return inst.DNSName
+	case "PrivateDNSName":
+		return inst.PrivateDNSName
+	case "IPAddress":
+		return inst.IPAddress
+	case "PrivateIPAddress":
+		return inst.PrivateIPAddress
+	case "AvailabilityZone":
+		return inst.AvailZone
+	case "InstanceType":
+		return inst.InstanceType
+	case "ImageId":
+		return inst.ImageId
+	case "KeyName":
+		return inst.KeyName
+	case "LaunchTime":
+		if inst.LaunchTime.IsZero() {
+			return ""
+		}
+		return inst.LaunchTime.UTC().Format(time.RFC3339)
+	case "Age":
+		if inst.LaunchTime.IsZero() {
+			return InstanceAge(0)
+		}
+		return InstanceAge(now.Sub(inst.LaunchTime))
+	case "Tags":
+		return InstanceTags(inst)
+	}
+	panic("unknown column " + col)
+}
+
+// the time since an instance was launched.  written as a duration rounded to
+// the second (e.g. "3h25m10s").
+type InstanceAge time.Duration
+
+func (a InstanceAge) String() string {
+	return ((time.Duration(a) / time.Second) * time.Second).String()
+}
+
+func (a InstanceAge) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// the named fields of r, in the given order.
+func selectFields(r otiout.Record, names []string) otiout.Record {
+	_r := make(otiout.Record, len(names))
+	for i, name := range names {
+		_r[i] = otiout.Field{Name: name, Value: r.Get(name)}
+	}
+	return _r
+}
+
+// a template that writes the given columns separated by tabs.
+func ColumnTemplate(cols []string) string {
+	fields := make([]string, len(cols))
+	for i, col := range cols {
+		fields[i] = fmt.Sprintf("{{index . %q}}", col)
+	}
+	return strings.Join(fields, "\t")
+}
+
+// sort records by the value of field col.  ages and numbers (including
+// numeric text) are compared numerically, other values as text.
+func SortRecords(rs []otiout.Record, col string, desc bool) {
+	s := recordsort{rs, col}
+	if desc {
+		sort.Stable(sort.Reverse(s))
+	} else {
+		sort.Stable(s)
+	}
+}
+
+type recordsort struct {
+	rs  []otiout.Record
+	col string
+}
+
+func (s recordsort) Len() int      { return len(s.rs) }
+func (s recordsort) Swap(i, j int) { s.rs[i], s.rs[j] = s.rs[j], s.rs[i] }
+func (s recordsort) Less(i, j int) bool {
+	a, b := s.rs[i].Get(s.col), s.rs[j].Get(s.col)
+	switch a := a.(type) {
+	case InstanceAge:
+		if b, ok := b.(InstanceAge); ok {
+			return a < b
+		}
+	case int:
+		if b, ok := b.(int); ok {
+			return a < b
+		}
+	}
+	as, bs := otiout.String(a), otiout.String(b)
+	if ai, err := strconv.Atoi(as); err == nil {
+		if bi, err := strconv.Atoi(bs); err == nil {
+			return ai < bi
+		}
+	}
+	return as < bs
+}
+
+// describe the addressed instances in all regions. closes sisch on return
+func DescribeSessionInstances(addr InstanceAddress, sisch chan<- SessionInstances) {
 	defer close(sisch)
+	session := addr.SessionId
 	wg := new(sync.WaitGroup)
 	for _, r := range Ec2Regions(false) {
 		r := r
 		wg.Add(1)
 		go func() {
-			ec2 := awsec2.New(auth, r)
-			resns, err := describeSessionInstances(ec2, session)
+			defer wg.Done()
+			ec2, err := NewEC2(r)
+			if err != nil {
+				sisch <- SessionInstances{Region: r, SessionId: session, Err: err}
+				return
+			}
+			resns, err := describeSessionInstances(ec2, addr)
 			if err != nil {
 				sisch <- SessionInstances{Region: r, SessionId: session, Err: err}
 			} else {
 				sisch <- SessionInstances{Region: r, SessionId: session, Reservations: resns}
 			}
-			wg.Done()
 		}()
 	}
 	wg.Wait()
 }
 
-func describeSessionInstances(ec2 *awsec2.EC2, session SessionId) ([]awsec2.Reservation, error) {
+func describeSessionInstances(ec2 *awsec2.EC2, addr InstanceAddress) ([]awsec2.Reservation, error) {
 	filter := awsec2.NewFilter()
-	if session != "" {
-		filter.Add("tag:"+Config.Ec2Tag(otitag.SessionId), string(session))
+	if addr.SessionId != "" {
+		filter.Add("tag:"+Config.Ec2Tag(otitag.SessionId), string(addr.SessionId))
 	} else {
 		filter.Add("tag-key", Config.Ec2Tag(otitag.SessionId))
 	}
+	if addr.Name != "" {
+		filter.Add("tag:"+Config.Ec2Tag(otitag.IManifest), addr.Name)
+	}
+	if addr.Index >= 0 {
+		filter.Add("tag:"+Config.Ec2Tag(otitag.IIndex), strconv.Itoa(addr.Index))
+	}
 
 	resp, err := ec2.DescribeInstances(nil, filter)
 	if err != nil {
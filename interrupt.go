@@ -0,0 +1,57 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// interrupt.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Interrupts
+
+commands that allocate or destroy resources (launch, terminate) do not exit
+immediately when interrupted.  the first interrupt (e.g. Ctrl-C) lets requests
+already sent to EC2 finish, so launched instances are still tagged with their
+session id, and then stops.  a second interrupt exits immediately.
+
+*/
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// returns a context that is canceled when the process receives SIGINT or
+// SIGTERM.  after the context is canceled another signal causes the process
+// to exit immediately.  stop must be called to release the signal handler.
+func InterruptContext() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigch := make(chan os.Signal, 2)
+	signal.Notify(sigch, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-sigch:
+			Log.Printf("received %v; finishing requests in flight (interrupt again to exit now)", sig)
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case <-sigch:
+			Log.Fatal("exiting immediately")
+		case <-done:
+		}
+	}()
+
+	stop = func() {
+		signal.Stop(sigch)
+		close(done)
+		cancel()
+	}
+	return ctx, stop
+}
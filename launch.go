@@ -16,22 +16,69 @@ oti-launch locates an image for each name provided and launches a specified
 number of instances for each image. the instances are all tagged with a common
 session identifier so they can be located later (e.g. for termination).
 
+	oti launch -idempotency-key=key name [directive ...] [-- name ...]
+
+when an idempotency key is given, launching is safe to retry.  instances are
+tagged with the key and EC2 client tokens are derived from the key and each
+manifest.  if a session tagged with the key exists its session id is reused
+and EC2 returns the instances it already launched instead of launching more.
+a key whose instances have all been terminated cannot be reused.
+
+	oti launch -region-profile=us-east-1/private name [directive ...]
+
+when the config defines several profiles for a region (see Ec2Region.Id in
+the oticonfig package) -region-profile selects the profile whose key name,
+security groups and role are used.  the region-profile directive selects the
+key name and security groups for a single manifest.  it is an error to launch
+in a region with several profiles without selecting one.
+
+	oti launch name version=~1.4 [directive ...]
+
+the version directive selects the image with the highest version
+(Images.VersionTag) satisfying a constraint (see the otiver package).  images
+with the same version are ordered by build date.  the image and version
+launched for each manifest are logged and included in output records as
+ImageId and ImageVersion.  the select directive chooses another image
+selection strategy (see resolve.go).  the channel directive only considers
+images in a release channel (see `oti images promote`).  -lock pins images to
+those recorded in a lockfile (see lock.go).  with -copy-from images missing
+from the launch region are copied from another region (see imagecopy.go).
+the build directive builds images with packer (see build.go).
+
+requests are recorded in a session journal while oti-launch runs (see `oti
+recover`).
+
+when oti assumes an iam role (see the oticonfig package) instances are tagged
+with the arn of the assumed role.  with -w oti-launch waits until no instance
+is pending, refreshing temporary credentials as needed.
+
+if oti-launch is interrupted it stops launching new instances but still tags
+any instances EC2 has already created.  the session id is printed so the
+session can be terminated later.  when -teardown is given the instances
+created before the interrupt are terminated immediately.
+
 */
 package main
 
 import (
 	"code.google.com/p/go-uuid/uuid"
+	"github.com/bmatsuo/oti/otijournal"
 	"github.com/bmatsuo/oti/otisub"
 	"github.com/bmatsuo/oti/otitag"
+	"github.com/bmatsuo/oti/otiver"
 	"github.com/crowdmob/goamz/aws"
 	awsec2 "github.com/crowdmob/goamz/ec2"
 
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"flag"
 	"fmt"
-	"sort"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 var launch = otisub.Register("launch", func(args []string) {
@@ -39,11 +86,19 @@ var launch = otisub.Register("launch", func(args []string) {
 	_sessionType := fs.String("s", "", "session type for management purposes")
 	_keyname := fs.String("keyname", "", "override the config KeyName for the region")
 	_secgroups := fs.String("secgroup", "", "security groups to add to the instances")
-	region := fs.String("r", "us-east-1", "region to run instances in")
+	region := fs.String("r", Config.Ec2.DefaultRegion, "region to run instances in")
+	regionProfile := fs.String("region-profile", "", "id of the config region profile to use (e.g. us-east-1/public)")
 	waitPending := fs.Bool("w", false, "wait while instances are 'pending'")
+	teardown := fs.Bool("teardown", false, "terminate launched instances if interrupted")
+	_copyFrom := fs.String("copy-from", "", "copy images missing from the launch region from this region")
+	lockPath := fs.String("lock", "", "pin images to those in this lockfile, adding any missing")
+	idempotencyKey := fs.String("idempotency-key", "", "launch at most once for this key; retries reuse the existing session")
 	fs.Parse(args)
 	args = fs.Args()
 
+	ctx, stop := InterruptContext()
+	defer stop()
+
 	umfts, err := ParseUserLaunchManifest(args)
 	if err != nil {
 		Log.Fatal(err)
@@ -53,49 +108,109 @@ var launch = otisub.Register("launch", func(args []string) {
 		Log.Fatal("no manifests")
 	}
 
-	awsregion := aws.Regions[*region]
-	if awsregion.Name == "" {
-		Log.Fatal("unknown ec2 region %q", *region)
+	awsregion, err := Config.AwsRegion(*region)
+	if err != nil {
+		Log.Fatal(err)
 	}
-	awsauth, err := Config.AwsAuth()
+	ec2, err := NewRegionProfileEC2(awsregion, *regionProfile)
 	if err != nil {
 		Log.Fatalln("error reading aws credentials: ", err)
 	}
 
-	keyname := *_keyname
-	if keyname == "" {
-		keyname = Config.Ec2KeyName(awsregion)
+	var secgroups []awsec2.SecurityGroup
+	if *_secgroups != "" {
+		secgroups = GuessSecurityGroups(strings.Split(*_secgroups, ","))
 	}
-	secgroups := Config.Ec2SecurityGroups(awsregion)
-	secgroups = append(secgroups, func() []awsec2.SecurityGroup {
-		if *_secgroups == "" {
-			return nil
+	for i := range umfts {
+		if umfts[i].RegionProfile == "" {
+			umfts[i].RegionProfile = *regionProfile
 		}
-		return GuessSecurityGroups(strings.Split(*_secgroups, ","))
-	}()...)
+	}
+	defaults, err := LaunchRegionDefaults(awsregion, *_keyname, secgroups, umfts)
+	if err != nil {
+		Log.Fatal(err)
+	}
 
-	ec2 := awsec2.New(awsauth, awsregion)
+	var copyFrom *aws.Region
+	if *_copyFrom != "" {
+		r, err := Config.AwsRegion(*_copyFrom)
+		if err != nil {
+			Log.Fatal(err)
+		}
+		copyFrom = &r
+	}
 
-	// find images based on manifest names (if no image is explicitly specified)
-	for _, mft := range ManifestsNeedingImageLookup(umfts) { // mft points into mfts
-		images, err := LookupImages(ec2, mft.Name, "")
+	var lock *ImageLock
+	if *lockPath != "" {
+		lock, err = ReadImageLock(*lockPath)
 		if err != nil {
-			Log.Fatal("error locating image ids: ", err)
+			Log.Fatal(err)
 		}
+	}
+	var lockChanged bool
 
-		if len(images) > 0 {
-			builddatetag := Config.Images.BuildDateTag
-			if builddatetag == "" {
-				Log.Fatal("no build date tag to order images")
+	// find images based on manifest names (if no image is explicitly specified)
+	for _, mft := range ManifestsNeedingImageLookup(umfts) { // mft points into mfts
+		resolver := &ImageResolver{
+			Name:     mft.Name,
+			Strategy: mft.ImageStrategy,
+			Version:  mft.Version,
+			ImageId:  mft.Ec2ImageId,
+			Channel:  mft.Channel,
+		}
+		uselock := lock != nil && mft.ImageStrategy != "id"
+		var image *awsec2.Image
+		locked, ok := LockedImage{}, false
+		if uselock {
+			locked, ok = lock.Get(mft.Name, awsregion.Name)
+			ok = ok && locked.Matches(resolver) && mft.Build != BuildAlways
+		}
+		if ok {
+			image, err = LookupImageId(ec2, locked.ImageId)
+			if err != nil {
+				Log.Fatalf("%s: locked image: %v (see `oti images update-lock`)", mft.Name, err)
 			}
-
-			SortImages(images, builddatetag, true)
-			if len(images) == 0 {
-				Log.Fatal("unable to locate images")
+		} else {
+			switch {
+			case mft.Build == BuildAlways:
+				image, err = BuildImage(ctx, ec2, *regionProfile, mft.Name)
+			case mft.Build == BuildIfMissing:
+				image, err = LookupOrBuildImage(ctx, ec2, *regionProfile, resolver)
+			case copyFrom != nil:
+				image, err = LookupOrCopyImage(ctx, ec2, *regionProfile, resolver, *copyFrom)
+			default:
+				image, err = resolver.Lookup(ec2)
+			}
+			if err != nil {
+				Log.Fatalf("%s: %v", mft.Name, err)
 			}
+			if uselock {
+				lock.Set(mft.Name, awsregion.Name, LockedImage{
+					ImageId:  image.Id,
+					Strategy: mft.ImageStrategy,
+					Version:  mft.Version,
+					Channel:  mft.Channel,
+				})
+				lockChanged = true
+			}
+		}
+		mft.Ec2ImageId = image.Id
+		mft.ImageVersion = imageTag(image, Config.Images.VersionTag)
+		if mft.ImageVersion != "" {
+			Log.Printf("%s: image %s version %s", mft.Name, image.Id, mft.ImageVersion)
+		} else {
+			Log.Printf("%s: image %s", mft.Name, image.Id)
 		}
+	}
+	if lockChanged {
+		err := lock.Write(*lockPath)
+		if err != nil {
+			Log.Fatal(err)
+		}
+	}
 
-		mft.Ec2ImageId = images[0].Id
+	if ctx.Err() != nil {
+		Log.Fatal("interrupted; no instances launched")
 	}
 
 	for _, m := range umfts {
@@ -116,21 +231,54 @@ var launch = otisub.Register("launch", func(args []string) {
 		}
 	}
 
-	sessionId, err := NewSessionId(sessionType)
-	if err != nil {
-		Log.Fatal(err)
+	var sessionId SessionId
+	if *idempotencyKey != "" {
+		sessionId, err = LocateIdempotentSession(ec2, *idempotencyKey)
+		if err != nil {
+			Log.Fatal("error locating sessions: ", err)
+		}
+		if sessionId != "" && *_sessionType != "" && sessionId.Type() != *_sessionType {
+			Log.Fatalf("idempotency key %q belongs to session %s", *idempotencyKey, sessionId)
+		}
+		if sessionId != "" && DEBUG {
+			Log.Printf("reusing session %s for idempotency key %q", sessionId, *idempotencyKey)
+		}
+	}
+	if sessionId == "" {
+		sessionId, err = NewSessionId(sessionType)
+		if err != nil {
+			Log.Fatal(err)
+		}
 	}
 
-	fmt.Println(sessionId) // to stdout
+	if DefaultOutput() {
+		fmt.Println(sessionId) // to stdout
+	}
 	if DEBUG {
 		Log.Println("session id: ", sessionId)
 	}
 
-	mfts, err := BuildSystemLaunchManifests(ec2, sessionId, keyname, secgroups, umfts)
+	mfts, err := BuildSystemLaunchManifests(ctx, ec2, sessionId, defaults, umfts)
 	if err != nil {
 		Log.Fatalln(err)
 	}
+	if *idempotencyKey != "" {
+		for i := range mfts {
+			mfts[i].IdempotencyKey = *idempotencyKey
+			mfts[i].Ec2.ClientToken = IdempotentClientToken(*idempotencyKey, i, mfts[i].Name)
+		}
+	}
+	creds, err := RegionCredentials(awsregion, *regionProfile)
+	if err != nil {
+		Log.Fatalln("error reading aws credentials: ", err)
+	}
+	for i := range mfts {
+		mfts[i].AssumedRole = creds.AssumedRole
+	}
+
+	journal := CreateJournal(string(sessionId), "launch", sessionId, awsregion)
 
+	out := NewOutput("{{.Manifest}} {{.InstanceId}} {{.State}}")
 	var haserrors bool
 	done := new(sync.WaitGroup)
 	ich := make(chan Instances)
@@ -141,7 +289,7 @@ var launch = otisub.Register("launch", func(args []string) {
 		}
 		done.Add(1)
 		go func(m LaunchManifest) {
-			RunInstances(ec2, m, ich)
+			RunInstances(ctx, ec2, m, journal, ich)
 			done.Done()
 		}(m)
 	}
@@ -152,11 +300,17 @@ var launch = otisub.Register("launch", func(args []string) {
 			if is.Err != nil {
 				haserrors = true
 				Log.Print(is.Err)
-			} else {
+			}
+			if len(is.Is) > 0 {
 				_is = append(_is, is)
-				for _, inst := range is.Is {
-					fmt.Printf("%s %s %s\n", is.M.Name, inst.InstanceId, inst.State.Name)
-				}
+			}
+			for i := range is.Is {
+				r := InstanceRecord(awsregion.Name, &is.Is[i])
+				r = r.Set("SessionId", is.M.SessionId)
+				r = r.Set("Manifest", is.M.Name)
+				r = r.Set("ImageId", is.M.Ec2.ImageId)
+				r = r.Set("ImageVersion", is.M.ImageVersion)
+				WriteOutput(out, r)
 			}
 		}
 	}()
@@ -164,28 +318,103 @@ var launch = otisub.Register("launch", func(args []string) {
 	done.Wait()
 	close(ich)
 	iss := <-_ich
-	_ = iss
+	CloseOutput(out)
+
+	if ctx.Err() != nil {
+		Log.Printf("launch interrupted. session id: %s", sessionId)
+		if *teardown {
+			if TeardownInstances(ec2, iss, journal) {
+				RemoveJournal(journal)
+			}
+		} else if len(iss) > 0 {
+			Log.Printf("to clean up run: oti terminate -r %s %s", awsregion.Name, sessionId)
+		}
+		os.Exit(1)
+	}
 
 	if haserrors {
+		if journal != nil {
+			Log.Printf("journal kept at %s. see `oti recover -h`", journal.Path())
+		}
 		Log.Fatal()
 	}
+	RemoveJournal(journal)
 
 	// wait for instances to boot
 	if *waitPending {
-		Log.Fatal("waiting not implemented")
+		err := WaitPending(ctx, ec2, *regionProfile, iss)
+		if err != nil {
+			Log.Fatal(err)
+		}
 	}
 })
 
+// the interval between checks of instance states while waiting
+var WaitInterval = 5 * time.Second
+
+// wait until no instance in iss is 'pending'.  credentials of ec2 are
+// refreshed before each check so waits may outlast temporary credentials.
+func WaitPending(ctx context.Context, ec2 *awsec2.EC2, regionProfile string, iss []Instances) error {
+	var ids []string
+	for _, is := range iss {
+		for _, inst := range is.Is {
+			ids = append(ids, inst.InstanceId)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	filter := awsec2.NewFilter()
+	filter.Add("instance-id", ids...)
+	filter.Add("instance-state-name", "pending")
+	for {
+		err := RefreshEC2(ec2, regionProfile)
+		if err != nil {
+			return err
+		}
+		resp, err := ec2.DescribeInstances(nil, filter)
+		if err != nil {
+			return err
+		}
+		var pending int
+		for _, resvn := range resp.Reservations {
+			pending += len(resvn.Instances)
+		}
+		if pending == 0 {
+			return nil
+		}
+		if DEBUG {
+			Log.Printf("waiting for %d pending instances", pending)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("interrupted while waiting for pending instances")
+		case <-time.After(WaitInterval):
+		}
+	}
+}
+
 type Instances struct {
 	M   LaunchManifest
 	Is  []awsec2.Instance
 	Err error
 }
 
-func RunInstances(ec2 *awsec2.EC2, m LaunchManifest, c chan<- Instances) {
+// launch the instances described by m and tag them with m.SessionId.  if ctx
+// is canceled before the instances are launched no instances are launched.
+// once EC2 has created instances they are tagged regardless of ctx.  requests
+// are recorded in journal, which may be nil.
+func RunInstances(ctx context.Context, ec2 *awsec2.EC2, m LaunchManifest, journal *otijournal.Journal, c chan<- Instances) {
 	is := Instances{M: m}
 	defer func() { c <- is }()
 
+	if ctx.Err() != nil {
+		is.Err = fmt.Errorf("manifest %q: not launched: %v", m.Name, ctx.Err())
+		return
+	}
+
 	var userData []byte
 	if m.Ec2.UserData != "" {
 		userData = []byte(m.Ec2.UserData)
@@ -198,9 +427,21 @@ func RunInstances(ec2 *awsec2.EC2, m LaunchManifest, c chan<- Instances) {
 		InstanceType:   m.Ec2.InstanceType,
 		SecurityGroups: m.Ec2.SecurityGroups,
 		UserData:       userData,
+		ClientToken:    m.Ec2.ClientToken,
 	}
+	entry := otijournal.Entry{
+		Op:          "RunInstances",
+		Manifest:    m.Name,
+		ClientToken: m.Ec2.ClientToken,
+		IndexOffset: m.IndexOffset,
+
+		IdempotencyKey: m.IdempotencyKey,
+		AssumedRole:    m.AssumedRole,
+	}
+	logJournalErr(journal.Begin(entry))
 	resp, err := ec2.RunInstances(runopts)
 	if err != nil {
+		logJournalErr(journal.End(entry, err))
 		is.Err = fmt.Errorf("manifest %q: error running isntances %v", m.Name, err)
 		return
 	}
@@ -210,15 +451,146 @@ func RunInstances(ec2 *awsec2.EC2, m LaunchManifest, c chan<- Instances) {
 	for _, inst := range resp.Instances {
 		ids = append(ids, inst.InstanceId)
 	}
-
-	tags := []awsec2.Tag{{Config.Ec2Tag(otitag.SessionId), string(m.SessionId)}}
+	entry.InstanceIds = ids
+	logJournalErr(journal.End(entry, nil))
+
+	// tags common to all instances are applied together.  the index tag
+	// differs for each instance.
+	tags := SessionTags(m.SessionId, m.Name, m.IdempotencyKey, m.AssumedRole)
+	entry = otijournal.Entry{Op: "CreateTags", Manifest: m.Name, InstanceIds: ids}
+	logJournalErr(journal.Begin(entry))
 	_, err = ec2.CreateTags(ids, tags)
+	for i := 0; err == nil && i < len(is.Is); i++ {
+		inst := &is.Is[i]
+		itags := []awsec2.Tag{
+			IndexTag(m.IndexOffset + inst.AMILaunchIndex),
+			ImageIdTag(inst.ImageId),
+		}
+		_, err = ec2.CreateTags([]string{inst.InstanceId}, itags)
+		if err == nil {
+			inst.Tags = append(inst.Tags, tags...)
+			inst.Tags = append(inst.Tags, itags...)
+		}
+	}
+	logJournalErr(journal.End(entry, err))
 	if err != nil {
 		is.Err = fmt.Errorf("manifest %q: error tagging instances: %v", m.Name, err)
 		return
 	}
 }
 
+// the tags shared by all instances launched for a manifest.  idempotencyKey
+// and assumedRole are optional.
+func SessionTags(sessionId SessionId, name, idempotencyKey, assumedRole string) []awsec2.Tag {
+	tags := []awsec2.Tag{
+		{Key: Config.Ec2Tag(otitag.SessionId), Value: string(sessionId)},
+		{Key: Config.Ec2Tag(otitag.IManifest), Value: name},
+	}
+	if idempotencyKey != "" {
+		tags = append(tags, awsec2.Tag{Key: Config.Ec2Tag(otitag.IdempotencyKey), Value: idempotencyKey})
+	}
+	if assumedRole != "" {
+		tags = append(tags, awsec2.Tag{Key: Config.Ec2Tag(otitag.AssumedRole), Value: assumedRole})
+	}
+	return tags
+}
+
+// the tag holding an instance's index among those launched for its manifest
+// name.
+func IndexTag(index int) awsec2.Tag {
+	return awsec2.Tag{Key: Config.Ec2Tag(otitag.IIndex), Value: strconv.Itoa(index)}
+}
+
+// the tag holding the id of the image an instance was launched from.  see
+// `oti images`
+func ImageIdTag(imageId string) awsec2.Tag {
+	return awsec2.Tag{Key: Config.Ec2Tag(otitag.IImageId), Value: imageId}
+}
+
+// returns the id of the session whose instances are tagged with the
+// idempotency key.  an empty id is returned if no such session exists.  see
+// IdempotentSession.
+func LocateIdempotentSession(ec2 *awsec2.EC2, key string) (SessionId, error) {
+	filter := awsec2.NewFilter()
+	filter.Add("tag:"+Config.Ec2Tag(otitag.IdempotencyKey), key)
+	resp, err := ec2.DescribeInstances(nil, filter)
+	if err != nil {
+		return "", err
+	}
+	return IdempotentSession(key, resp.Reservations)
+}
+
+// returns the id of the session of the instances in rs, which are tagged with
+// the idempotency key.  an error is returned if the key is shared by multiple
+// sessions or if every instance has been terminated, because EC2 would return
+// the terminated instances for the key's client tokens.
+func IdempotentSession(key string, rs []awsec2.Reservation) (SessionId, error) {
+	sessionidtag := Config.Ec2Tag(otitag.SessionId)
+	var sessionId SessionId
+	live := false
+	for _, resvn := range rs {
+		for _, inst := range resvn.Instances {
+			for _, tag := range inst.Tags {
+				if tag.Key != sessionidtag {
+					continue
+				}
+				id := SessionId(tag.Value)
+				if sessionId != "" && id != sessionId {
+					return "", fmt.Errorf("idempotency key %q used by sessions %s and %s", key, sessionId, id)
+				}
+				sessionId = id
+			}
+			switch inst.State.Name {
+			case "shutting-down", "terminated":
+			default:
+				live = true
+			}
+		}
+	}
+	if sessionId != "" && !live {
+		return "", fmt.Errorf("idempotency key %q belongs to session %s, which has been terminated", key, sessionId)
+	}
+	return sessionId, nil
+}
+
+// returns an EC2 client token for the i-th manifest of a launch with the
+// given idempotency key.  the token is the same each time the launch is run.
+func IdempotentClientToken(key string, i int, name string) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%s", key, i, name)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// terminate instances launched before an interrupt.  errors are logged.
+// returns true if all instances were terminated.
+func TeardownInstances(ec2 *awsec2.EC2, iss []Instances, journal *otijournal.Journal) bool {
+	var ids []string
+	for _, is := range iss {
+		for _, inst := range is.Is {
+			ids = append(ids, inst.InstanceId)
+		}
+	}
+	if len(ids) == 0 {
+		return true
+	}
+
+	entry := otijournal.Entry{Op: "TerminateInstances", InstanceIds: ids}
+	logJournalErr(journal.Begin(entry))
+	resp, err := ec2.TerminateInstances(ids)
+	logJournalErr(journal.End(entry, err))
+	if err != nil {
+		Log.Printf("error terminating instances %v: %v", ids, err)
+		return false
+	}
+	for _, change := range resp.StateChanges {
+		Log.Printf("%s %s (was %s)",
+			change.InstanceId,
+			change.CurrentState.Name,
+			change.PreviousState.Name)
+	}
+	return true
+}
+
 func GuessSecurityGroups(s []string) []awsec2.SecurityGroup {
 	sgs := make([]awsec2.SecurityGroup, len(s))
 	for i := range s {
@@ -235,37 +607,89 @@ func GuessSecurityGroup(s string) awsec2.SecurityGroup {
 	}
 }
 
+// the key name and security groups given to instances of a region profile
+// unless their manifest specifies its own.
+type RegionDefaults struct {
+	KeyName        string
+	SecurityGroups []awsec2.SecurityGroup
+}
+
+// returns the defaults of each region profile used by umfts, keyed by
+// ULM.RegionProfile.  a non-empty keyname overrides the key name of every
+// region profile and secgroups are added to the groups of each.  an error is
+// returned if a region profile is unknown or ambiguous.
+func LaunchRegionDefaults(region aws.Region, keyname string, secgroups []awsec2.SecurityGroup, umfts []ULM) (map[string]RegionDefaults, error) {
+	defaults := make(map[string]RegionDefaults)
+	for _, um := range umfts {
+		if _, ok := defaults[um.RegionProfile]; ok {
+			continue
+		}
+		var d RegionDefaults
+		var err error
+		d.KeyName = keyname
+		if d.KeyName == "" {
+			d.KeyName, err = Config.Ec2KeyName(region, um.RegionProfile)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", um.Name, err)
+			}
+		}
+		d.SecurityGroups, err = Config.Ec2SecurityGroups(region, um.RegionProfile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", um.Name, err)
+		}
+		d.SecurityGroups = append(d.SecurityGroups, secgroups...)
+		defaults[um.RegionProfile] = d
+	}
+	return defaults, nil
+}
+
 // create LaunchManifests from the given ULMs. the manifests are given the
-// provided session id and, if the ULM does not specify a ec2 key name, the
-// provided keyname as well.
-func BuildSystemLaunchManifests(ec2 *awsec2.EC2, sessionId SessionId, keyname string, defaultSecgroups []awsec2.SecurityGroup, umfts []ULM) ([]LaunchManifest, error) {
+// provided session id and the defaults of their region profile. an error is
+// returned if ctx is canceled before the manifests are built.
+func BuildSystemLaunchManifests(ctx context.Context, ec2 *awsec2.EC2, sessionId SessionId, defaults map[string]RegionDefaults, umfts []ULM) ([]LaunchManifest, error) {
 	mfts := make([]LaunchManifest, len(umfts))
 
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
 	// get real security groups.
+	var defaultSecgroups []awsec2.SecurityGroup
+	for _, d := range defaults {
+		defaultSecgroups = append(defaultSecgroups, d.SecurityGroups...)
+	}
 	secgroups, err := LookupSecurityGroups(ec2, defaultSecgroups, umfts)
 	if err != nil {
 		return nil, fmt.Errorf("error locating up security groups: %v", err)
 	}
-	_defaultSecgroups := make([]awsec2.SecurityGroup, len(defaultSecgroups))
-	for i, group := range defaultSecgroups {
-		for _, info := range secgroups {
-			sg := info.SecurityGroup
-			if sg.Id == group.Id {
-				_defaultSecgroups[i] = sg
-				continue
-			} else if sg.Name == group.Name {
-				_defaultSecgroups[i] = sg
-				continue
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	_defaults := make(map[string][]awsec2.SecurityGroup, len(defaults))
+	for id, d := range defaults {
+		_defaultSecgroups := make([]awsec2.SecurityGroup, len(d.SecurityGroups))
+		for i, group := range d.SecurityGroups {
+			for _, info := range secgroups {
+				sg := info.SecurityGroup
+				if group.Id != "" && sg.Id == group.Id {
+					_defaultSecgroups[i] = sg
+				} else if group.Name != "" && sg.Name == group.Name {
+					_defaultSecgroups[i] = sg
+				}
+			}
+			if _defaultSecgroups[i].Id == "" {
+				return nil, fmt.Errorf("unknown default security group %#v", group)
 			}
 		}
-		if _defaultSecgroups[i].Id == "" {
-			return nil, fmt.Errorf("unknown default security group %#v", group)
-		}
+		_defaults[id] = _defaultSecgroups
 	}
 
 	// get key pairs TODO
 
-	// build each LaunchManifest
+	// build each LaunchManifest. instances launched for manifests with the
+	// same name are indexed consecutively.
+	offsets := make(map[string]int)
 	for i := range umfts {
 		m := &mfts[i]
 		um := &umfts[i]
@@ -273,14 +697,18 @@ func BuildSystemLaunchManifests(ec2 *awsec2.EC2, sessionId SessionId, keyname st
 		m.Name = um.Name
 		m.Min = um.Min
 		m.Max = um.Max
+		m.IndexOffset = offsets[m.Name]
+		offsets[m.Name] += m.Max
 		m.Ec2.InstanceType = um.Ec2InstanceType
 		m.Ec2.UserData = um.Ec2UserData
 		m.Ec2.ImageId = um.Ec2ImageId
+		m.ImageVersion = um.ImageVersion
+		m.Ec2.ClientToken = uuid.New()
 		m.Ec2.KeyName = um.Ec2KeyName
 		if m.Ec2.KeyName == "" {
-			m.Ec2.KeyName = keyname
+			m.Ec2.KeyName = defaults[um.RegionProfile].KeyName
 		}
-		m.Ec2.SecurityGroups = append(m.Ec2.SecurityGroups, _defaultSecgroups...)
+		m.Ec2.SecurityGroups = append(m.Ec2.SecurityGroups, _defaults[um.RegionProfile]...)
 		for _, group := range um.Ec2SecGroups {
 			found := false
 			for _, info := range secgroups {
@@ -319,15 +747,17 @@ func LookupSecurityGroups(ec2 *awsec2.EC2, secgroups []awsec2.SecurityGroup, mft
 func ManifestsNeedingImageLookup(ulms []ULM) []*ULM {
 	var _ulms []*ULM
 	for i := range ulms {
-		if ulms[i].Ec2ImageId == "" {
+		if ulms[i].Ec2ImageId == "" || ulms[i].ImageStrategy == "id" {
 			_ulms = append(_ulms, &ulms[i])
 		}
 	}
 	return _ulms
 }
 
-// lookup images based on tags specified in the config file
-func LookupImages(ec2 *awsec2.EC2, name, version string) ([]awsec2.Image, error) {
+// lookup images based on tags specified in the config file.  if channel is
+// not empty only images in the release channel are returned.  see
+// ImageResolver to select among them.
+func LookupImages(ec2 *awsec2.EC2, name, channel string) ([]awsec2.Image, error) {
 	nametag := Config.Images.NameTag
 	if nametag == "" {
 		return nil, fmt.Errorf("no name tag to identify images without explicit image ids")
@@ -335,16 +765,15 @@ func LookupImages(ec2 *awsec2.EC2, name, version string) ([]awsec2.Image, error)
 	if name == "" {
 		return nil, fmt.Errorf("no image name given")
 	}
-
-	versiontag := Config.Images.VersionTag
-	if version != "" && versiontag == "" {
-		return nil, fmt.Errorf("no version tag to identify images with")
+	channeltag := Config.Images.ChannelTag
+	if channel != "" && channeltag == "" {
+		return nil, fmt.Errorf("no channel tag to identify images with")
 	}
 
 	filter := awsec2.NewFilter()
 	filter.Add("tag:"+nametag, name)
-	if version != "" {
-		filter.Add("tag"+versiontag, version)
+	if channel != "" {
+		filter.Add("tag-key", channeltag)
 	}
 
 	resp, err := ec2.Images(nil, filter)
@@ -353,52 +782,35 @@ func LookupImages(ec2 *awsec2.EC2, name, version string) ([]awsec2.Image, error)
 	}
 
 	images := resp.Images
+	if channel == "" {
+		return images, nil
+	}
 
-	return images, nil
-}
-
-func SortImages(images []awsec2.Image, tagname string, reverse bool) {
-	s := new(imgsort)
-	s.images = images
-	s.tagval = make([]string, len(images))
-
+	// an image may be in several channels so membership is checked here.
+	var _images []awsec2.Image
 	for i := range images {
-		for _, tag := range images[i].Tags {
-			if tag.Key == tagname {
-				s.tagval[i] = tag.Value
-				break
-			}
+		if ImageInChannel(&images[i], channel) {
+			_images = append(_images, images[i])
 		}
 	}
-
-	if reverse {
-		sort.Reverse(s)
-	} else {
-		sort.Sort(s)
-	}
-}
-
-type imgsort struct {
-	tagval []string
-	images []awsec2.Image
-}
-
-func (s imgsort) Len() int           { return len(s.images) }
-func (s imgsort) Less(i, j int) bool { return s.tagval[i] < s.tagval[j] }
-func (s imgsort) Swap(i, j int) {
-	s.tagval[i], s.tagval[j] = s.tagval[j], s.tagval[i]
-	s.images[i], s.images[j] = s.images[j], s.images[i]
+	return _images, nil
 }
 
 // User Launch Manifest -- information read from the command line
 type ULM struct {
 	Name            string   // OTI name that can be used to filter images
 	LatestBuild     bool     // if no image specified use the latest built with matching tags
+	Version         string   // constraint on the version of the image
+	ImageStrategy   string   // name of the image selection strategy
+	Channel         string   // release channel of the image
+	Build           string   // when to build the image with packer, if ever
+	ImageVersion    string   // version of the located image
 	Ec2UserData     string   // AWS EC2 user-data available through the instance metadata API.
 	Ec2ImageId      string   // AWS EC2 image id.
 	Ec2InstanceType string   // AWS EC2 instance type.
 	Ec2KeyName      string   // AWS EC2 key pair name
 	Ec2SecGroups    []string // Security groups to assign the instances
+	RegionProfile   string   // id of the config region profile
 	Min, Max        int      // may not be empty
 }
 
@@ -420,11 +832,16 @@ var ErrEndOfArgs = ArgumentError{-1, fmt.Errorf("no more arguments")}
 //	min              1
 //	max              1
 //	latest           true
+//	version          ""          a version constraint (e.g. "~1.4")
+//	select           ""          an image selection strategy (see resolve.go)
+//	channel          ""          a release channel (see `oti images promote`)
+//	build            ""          "ifmissing" or "always" (see build.go)
 //	ec2type          "t1.micro"
 //	ami              ""
 //	keyname          ""
 //	secgroup         ""
 //	userdata         ""          will be base64 encoded automatically
+//	region-profile   ""          id of a config region profile (see Ec2Region.Id)
 func ParseUserLaunchManifest(args []string) ([]ULM, error) {
 	ulms := make([]ULM, 0, len(args))
 	sepseq := "--"
@@ -468,7 +885,7 @@ func ParseUserLaunchManifest(args []string) ([]ULM, error) {
 			}
 
 			switch key {
-			case "min", "max", "userdata", "secgroup", "ami", "keyname", "ec2type", "latest":
+			case "min", "max", "userdata", "secgroup", "ami", "keyname", "ec2type", "latest", "version", "select", "channel", "build", "region-profile":
 			default:
 				err := fmt.Errorf("unexpected flag %v", key)
 				return retErr(ulmErr(err))
@@ -506,6 +923,51 @@ func ParseUserLaunchManifest(args []string) ([]ULM, error) {
 						}
 					}
 				}
+			case "version":
+				if numvs > 1 {
+					err = fmt.Errorf("specified multiple times")
+				} else if len(flags["ami"]) > 0 {
+					err = fmt.Errorf(`cannot be specified with "ami"`)
+				} else {
+					_, err = otiver.ParseConstraint(vs[0])
+					ulm.Version = vs[0]
+				}
+			case "select":
+				if numvs > 1 {
+					err = fmt.Errorf("specified multiple times")
+				} else if _, ok := ImageStrategies[vs[0]]; !ok {
+					err = fmt.Errorf("unknown strategy (one of %s)", strings.Join(ImageStrategyNames(), ", "))
+				} else if vs[0] == "id" && len(flags["ami"]) == 0 {
+					err = fmt.Errorf(`"id" requires "ami"`)
+				} else if vs[0] != "id" && len(flags["ami"]) > 0 {
+					err = fmt.Errorf(`cannot be specified with "ami"`)
+				} else if vs[0] != "version" && len(flags["version"]) > 0 {
+					err = fmt.Errorf(`cannot be specified with "version"`)
+				} else {
+					ulm.ImageStrategy = vs[0]
+				}
+			case "channel":
+				if numvs > 1 {
+					err = fmt.Errorf("specified multiple times")
+				} else if len(flags["ami"]) > 0 {
+					err = fmt.Errorf(`cannot be specified with "ami"`)
+				} else {
+					err = validChannel(vs[0])
+					ulm.Channel = vs[0]
+				}
+			case "build":
+				switch {
+				case numvs > 1:
+					err = fmt.Errorf("specified multiple times")
+				case vs[0] != BuildIfMissing && vs[0] != BuildAlways:
+					err = fmt.Errorf("must be %q or %q", BuildIfMissing, BuildAlways)
+				case len(flags["ami"]) > 0:
+					err = fmt.Errorf(`cannot be specified with "ami"`)
+				case len(flags["version"]) > 0 || len(flags["channel"]) > 0:
+					err = fmt.Errorf(`built images have no version or channel`)
+				default:
+					ulm.Build = vs[0]
+				}
 			case "secgroup":
 				ulm.Ec2SecGroups = vs
 			case "ec2type":
@@ -523,7 +985,7 @@ func ParseUserLaunchManifest(args []string) ([]ULM, error) {
 			case "ami":
 				if numvs > 1 {
 					err = fmt.Errorf("specified multiple times")
-				} else if !strings.HasPrefix(vs[0], "i-") {
+				} else if !strings.HasPrefix(vs[0], "ami-") {
 					err = fmt.Errorf("invalid image id")
 				} else {
 					ulm.Ec2ImageId = vs[0]
@@ -534,6 +996,12 @@ func ParseUserLaunchManifest(args []string) ([]ULM, error) {
 				} else {
 					ulm.Ec2KeyName = vs[0]
 				}
+			case "region-profile":
+				if numvs > 1 {
+					err = fmt.Errorf("specified multiple times")
+				} else {
+					ulm.RegionProfile = vs[0]
+				}
 			}
 			if err != nil {
 				return retErr(ulmFlagErr(k, err))
@@ -569,15 +1037,20 @@ func ParseUserLaunchManifest(args []string) ([]ULM, error) {
 }
 
 type LaunchManifest struct {
-	Name      string    // configured by the user
-	Min, Max  int       // configured by the user
-	SessionId SessionId // generated at runtime
-	Ec2       struct {
+	Name           string    // configured by the user
+	Min, Max       int       // configured by the user
+	SessionId      SessionId // generated at runtime
+	IdempotencyKey string    // configured by the user
+	IndexOffset    int       // index of the manifest's first instance
+	AssumedRole    string    // the role used to launch, if any
+	ImageVersion   string    // version of the located image, if any
+	Ec2            struct {
 		ImageId        string                 // located AWS image id
 		InstanceType   string                 // configured by the user
 		KeyName        string                 // configured by the user or generated at run-time
 		UserData       string                 // configured by the user
 		SecurityGroups []awsec2.SecurityGroup // configured by the user or created at runtime
+		ClientToken    string                 // generated at runtime
 	}
 }
 
@@ -587,6 +1060,10 @@ func NewSessionId(sessiontype string) (SessionId, error) {
 	if strings.Contains(sessiontype, ":") {
 		return "", fmt.Errorf("session type cannot contain ':'")
 	}
+	if strings.Contains(sessiontype, "/") {
+		return "", fmt.Errorf("session type cannot contain '/'")
+	}
+
 	if sessiontype == "" {
 		sessiontype = "session"
 	}
@@ -0,0 +1,78 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/bmatsuo/oti/otitag"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"strings"
+	"testing"
+)
+
+func TestIdempotentClientToken(t *testing.T) {
+	for _, test := range []struct {
+		key   string
+		i     int
+		name  string
+		token string
+	}{
+		{"key", 0, "web", "c9cbef67a2fbf719dcb0f69c2b48af629aa672a4"},
+		{"key", 1, "web", "6daf7339aeac63032cff2151a5b1dcf108577c56"},
+		{"key", 0, "db", "8f208233a15c19893f2e7f5873efd2f4ad5406d5"},
+		{"other", 0, "web", "ee0045850eef94b32bc60ae80ebd08e46981f306"},
+	} {
+		token := IdempotentClientToken(test.key, test.i, test.name)
+		if token != test.token {
+			t.Errorf("%q %d %q: token %s (expected %s)", test.key, test.i, test.name, token, test.token)
+		}
+		// ec2 client tokens are limited to 64 ascii characters.
+		if len(token) > 64 {
+			t.Errorf("%q %d %q: token too long", test.key, test.i, test.name)
+		}
+	}
+}
+
+func TestIdempotentSession(t *testing.T) {
+	tag := Config.Ec2Tag(otitag.SessionId)
+	inst := func(session, state string) awsec2.Instance {
+		return awsec2.Instance{
+			State: awsec2.InstanceState{Name: state},
+			Tags:  []awsec2.Tag{{Key: tag, Value: session}},
+		}
+	}
+	for _, test := range []struct {
+		desc    string
+		rs      []awsec2.Reservation
+		session SessionId
+		err     string
+	}{
+		{"unused key", nil, "", ""},
+		{"running", []awsec2.Reservation{
+			{Instances: []awsec2.Instance{inst("web:1", "running"), inst("web:1", "pending")}},
+		}, "web:1", ""},
+		{"partly terminated", []awsec2.Reservation{
+			{Instances: []awsec2.Instance{inst("web:1", "terminated")}},
+			{Instances: []awsec2.Instance{inst("web:1", "stopped")}},
+		}, "web:1", ""},
+		{"terminated", []awsec2.Reservation{
+			{Instances: []awsec2.Instance{inst("web:1", "terminated"), inst("web:1", "shutting-down")}},
+		}, "", "has been terminated"},
+		{"collision", []awsec2.Reservation{
+			{Instances: []awsec2.Instance{inst("web:1", "running")}},
+			{Instances: []awsec2.Instance{inst("web:2", "running")}},
+		}, "", "used by sessions web:1 and web:2"},
+	} {
+		session, err := IdempotentSession("key", test.rs)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: %v", test.desc, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: error %v (expected %q)", test.desc, err, test.err)
+		case session != test.session:
+			t.Errorf("%s: session %q (expected %q)", test.desc, session, test.session)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// lock.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Image lockfiles
+
+a lockfile pins the image launched for each name and region so that sessions
+launched on different days use the same images.
+
+	oti launch -lock oti.lock name [directive ...]
+	oti images update-lock [-lock oti.lock] [-r region] [name ...]
+
+when launching with -lock, names locked for the region use the locked image.
+other names are resolved as usual and added to the lockfile before instances
+are launched.  the directives used to select an image (version, channel and
+select) are locked with it; when they change the name is resolved again.
+
+images update-lock resolves every locked name and region again and rewrites
+the lockfile.  when names are given only those names are updated, and names
+not yet locked are added for the region given by -r (or the default region).
+when -r is given names locked only in other regions are added for the region,
+selected by the directives they were locked with.
+
+lockfiles are json and meant to be checked in next to the tests using them.
+
+	{
+		"Images": {
+			"web": {
+				"us-east-1": {"ImageId": "ami-12345678", "Version": "~1.4"}
+			}
+		}
+	}
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/otiout"
+	"github.com/bmatsuo/oti/otisub"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// the default lockfile of `oti images update-lock`
+const DefaultLockPath = "oti.lock"
+
+// images pinned by name and region.  see the package documentation.
+type ImageLock struct {
+	Images map[string]map[string]LockedImage
+}
+
+// a locked image and the directives that selected it.
+type LockedImage struct {
+	ImageId  string
+	Strategy string `json:",omitempty"`
+	Version  string `json:",omitempty"`
+	Channel  string `json:",omitempty"`
+}
+
+// the locked image selected by the same directives as r.
+func (l LockedImage) Matches(r *ImageResolver) bool {
+	return l.Strategy == r.Strategy && l.Version == r.Version && l.Channel == r.Channel
+}
+
+// the resolver that selected l.
+func (l LockedImage) Resolver(name string) *ImageResolver {
+	return &ImageResolver{Name: name, Strategy: l.Strategy, Version: l.Version, Channel: l.Channel}
+}
+
+// read the lockfile at path.  a missing file is an empty lock.
+func ReadImageLock(path string) (*ImageLock, error) {
+	l := &ImageLock{Images: make(map[string]map[string]LockedImage)}
+	p, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(p, l)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if l.Images == nil {
+		l.Images = make(map[string]map[string]LockedImage)
+	}
+	return l, nil
+}
+
+// write l to path, replacing any existing file atomically.
+func (l *ImageLock) Write(path string) error {
+	p, err := json.MarshalIndent(l, "", "\t")
+	if err != nil {
+		return err
+	}
+	p = append(p, '\n')
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(p)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// the image locked for name in region.
+func (l *ImageLock) Get(name, region string) (LockedImage, bool) {
+	img, ok := l.Images[name][region]
+	return img, ok
+}
+
+// the resolver for name in a region where it is not locked.  the directives
+// name is locked with in another region are used, if there are any.
+func (l *ImageLock) Resolver(name string) *ImageResolver {
+	var regions []string
+	for r := range l.Images[name] {
+		regions = append(regions, r)
+	}
+	if len(regions) == 0 {
+		return &ImageResolver{Name: name}
+	}
+	sort.Strings(regions)
+	return l.Images[name][regions[0]].Resolver(name)
+}
+
+// lock img for name in region.
+func (l *ImageLock) Set(name, region string, img LockedImage) {
+	if l.Images[name] == nil {
+		l.Images[name] = make(map[string]LockedImage)
+	}
+	l.Images[name][region] = img
+}
+
+func ImageUpdateLockMain(args []string) {
+	fs := otisub.FlagSet(flag.ExitOnError, "images update-lock", "[name ...]")
+	path := fs.String("lock", DefaultLockPath, "the lockfile to update")
+	region := fs.String("r", "", "only update names in this region")
+	fs.Parse(args)
+	names := fs.Args()
+
+	lock, err := ReadImageLock(*path)
+	if err != nil {
+		Log.Fatal(err)
+	}
+
+	type target struct {
+		name   string
+		region string
+	}
+	var targets []target
+	if len(names) == 0 {
+		for name := range lock.Images {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		var regions []string
+		for r := range lock.Images[name] {
+			if *region == "" || r == *region {
+				regions = append(regions, r)
+			}
+		}
+		sort.Strings(regions)
+		if len(regions) == 0 && (lock.Images[name] == nil || *region != "") {
+			r := *region
+			if r == "" {
+				r = Config.Ec2.DefaultRegion
+			}
+			regions = append(regions, r)
+		}
+		for _, r := range regions {
+			targets = append(targets, target{name, r})
+		}
+	}
+	if len(targets) == 0 {
+		Log.Fatal("nothing to update")
+	}
+
+	out := NewOutput("{{.Name}}\t{{.Region}}\t{{.ImageId}}{{if .Changed}}\t(was {{.Previous}}){{end}}")
+	for _, t := range targets {
+		awsregion, err := Config.AwsRegion(t.region)
+		if err != nil {
+			Log.Fatal(err)
+		}
+		ec2, err := NewEC2(awsregion)
+		if err != nil {
+			Log.Fatal("error reading aws credentials: ", err)
+		}
+		prev, ok := lock.Get(t.name, t.region)
+		resolver := prev.Resolver(t.name)
+		if !ok {
+			resolver = lock.Resolver(t.name)
+		}
+		locked, err := LockImage(ec2, lock, t.name, resolver)
+		if err != nil {
+			Log.Fatalf("%s: %s: %v", t.name, t.region, err)
+		}
+		WriteOutput(out, otiout.Record{
+			{Name: "Name", Value: t.name},
+			{Name: "Region", Value: t.region},
+			{Name: "ImageId", Value: locked.ImageId},
+			{Name: "Previous", Value: prev.ImageId},
+			{Name: "Changed", Value: prev.ImageId != "" && prev.ImageId != locked.ImageId},
+		})
+	}
+	CloseOutput(out)
+
+	err = lock.Write(*path)
+	if err != nil {
+		Log.Fatal(err)
+	}
+}
+
+// resolve the image for name using r and lock it for the region of ec2.
+func LockImage(ec2 *awsec2.EC2, lock *ImageLock, name string, r *ImageResolver) (LockedImage, error) {
+	image, err := r.Lookup(ec2)
+	if err != nil {
+		return LockedImage{}, err
+	}
+	locked := LockedImage{
+		ImageId:  image.Id,
+		Strategy: r.Strategy,
+		Version:  r.Version,
+		Channel:  r.Channel,
+	}
+	lock.Set(name, ec2.Region.Name, locked)
+	return locked, nil
+}
@@ -8,33 +8,63 @@ package main
 
 import (
 	"github.com/bmatsuo/oti/oticonfig"
+	"github.com/bmatsuo/oti/oticreds"
 	"github.com/bmatsuo/oti/otisub"
+	"github.com/crowdmob/goamz/aws"
+	awsec2 "github.com/crowdmob/goamz/ec2"
 
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
 var DEBUG bool
 
+// see output.go
+var OutputFormat string
+
 var OTIVersion = "0.1"
 var OTIAgent = "oti"
 
-// default configuration informatio
-var ConfigPath = "oti.json"
+// default configuration informatio.  when ConfigPath is empty the files
+// returned by oticonfig.SearchPaths are read.
+var ConfigPath = ""
+
+// the selected profile. Config holds the profile's configuration and
+// RawConfig the configuration as it was read.
+var ProfileName = os.Getenv("OTI_PROFILE")
+var RawConfig *oticonfig.C
+
 var Config = &oticonfig.C{
 	AwsKeyPath: "aws_credentials.json",
 	Ec2: oticonfig.Ec2{
-		TagPrefix: "co.bmats.oti.",
+		TagPrefix:     "co.bmats.oti.",
+		DefaultRegion: "us-east-1",
 	},
 }
 
+// the source of each value in Config.  values are taken from the first of
+// -set flags, OTI_* environment variables, the config file (and profile), and
+// defaults.  see `oti config show`
+var ConfigSources oticonfig.Sources
+var ConfigSets setFlags
+var configDefaults []oticonfig.Field
+var configLayers []oticonfig.Layer
+
 var Log = log.New(os.Stderr, "", 0)
 
 func main() {
 	fs := flag.NewFlagSet("oti", flag.ExitOnError)
 	fs.BoolVar(&DEBUG, "debug", false, "debug logging output")
-	fs.StringVar(&ConfigPath, "c", ConfigPath, "config file location")
+	fs.StringVar(&ConfigPath, "c", ConfigPath, "config file location (default: search for oti.json)")
+	fs.StringVar(&ProfileName, "profile", ProfileName, "config profile to use (default $OTI_PROFILE)")
+	fs.StringVar(&OutputFormat, "o", "", "output format: json, jsonl, csv, table or a text/template")
+	fs.Var(&ConfigSets, "set", "override a config field (e.g. -set Ec2.TagPrefix=com.example.)")
+
 	fs.Usage = func() {
 		Log.Println("usage: oti [options] command")
 		Log.Println()
@@ -58,18 +88,152 @@ func main() {
 		Log.Fatal("for a list of commands run oti -h")
 	}
 
-	err := oticonfig.Read(ConfigPath, Config)
-	if err != nil {
-		if os.IsNotExist(err) {
-			Log.Println("warning: config file not found. using defaults.")
-		} else {
-			Log.Fatal("error reading config: ", err)
+	configDefaults = Config.Fields()
+	paths := oticonfig.SearchPaths()
+	if ConfigPath != "" {
+		paths = nil
+		if _, err := os.Stat(ConfigPath); !os.IsNotExist(err) {
+			paths = []string{ConfigPath}
 		}
 	}
+	if len(paths) == 0 {
+		Log.Println("warning: config file not found. using defaults.")
+	}
+	if DEBUG {
+		Log.Printf("config files: %v", paths)
+	}
+	oticreds.Warn = func(msg string) { Log.Print("warning: ", msg) }
+	layers, warnings, err := oticonfig.Load(paths, Config)
+	for _, w := range warnings {
+		Log.Print("warning: ", w)
+	}
+	if err != nil {
+		Log.Fatal("error reading config: ", err)
+	}
+	configLayers = layers
+	RawConfig = Config
+	err = UseProfile(ProfileName)
+	if err != nil {
+		Log.Fatal(err)
+	}
 
 	cmd.Main(args)
 }
 
+// credentials are cached per profile, region and region profile so temporary
+// credentials are only requested again when they are about to expire.
+var credentialCache = make(map[string]*oticreds.Cache)
+var credentialCacheMut sync.Mutex
+
+// locate aws credentials for use with the region profile of region with the
+// given id (see oticonfig.C.Ec2Region).  if Config has a role to assume in
+// the region profile the role's temporary credentials are returned.  in debug
+// mode the source of the credentials is logged.
+func RegionCredentials(region aws.Region, regionProfile string) (*oticreds.Credentials, error) {
+	credentialCacheMut.Lock()
+	key := ProfileName + "/" + region.Name + "/" + regionProfile
+	cache := credentialCache[key]
+	if cache == nil {
+		p, err := Config.RegionCredentials(region, regionProfile)
+		if err != nil {
+			credentialCacheMut.Unlock()
+			return nil, err
+		}
+		cache = &oticreds.Cache{Provider: p, Window: 5 * time.Minute}
+		credentialCache[key] = cache
+	}
+	credentialCacheMut.Unlock()
+
+	creds, err := cache.Retrieve()
+	if err != nil {
+		return nil, err
+	}
+	if DEBUG {
+		Log.Printf("aws credentials (%s): %s", region.Name, creds.Source)
+	}
+	return creds, nil
+}
+
+// returns an ec2 client for region using RegionCredentials.
+func NewEC2(region aws.Region) (*awsec2.EC2, error) {
+	return NewRegionProfileEC2(region, "")
+}
+
+// returns an ec2 client for the region profile of region with the given id.
+func NewRegionProfileEC2(region aws.Region, regionProfile string) (*awsec2.EC2, error) {
+	creds, err := RegionCredentials(region, regionProfile)
+	if err != nil {
+		return nil, err
+	}
+	return awsec2.New(oticonfig.CredentialsAuth(creds), region), nil
+}
+
+// replaces the credentials of ec2, a client for the given region profile, if
+// they are about to expire.  long running commands call RefreshEC2 before
+// each request.
+func RefreshEC2(ec2 *awsec2.EC2, regionProfile string) error {
+	creds, err := RegionCredentials(ec2.Region, regionProfile)
+	if err != nil {
+		return err
+	}
+	ec2.Auth = oticonfig.CredentialsAuth(creds)
+	return nil
+}
+
+// select the named profile of RawConfig, replacing Config.  environment
+// variables and -set flags are applied to the profile.
+func UseProfile(name string) error {
+	c, err := RawConfig.Profile(name)
+	if err != nil {
+		return err
+	}
+
+	src := make(oticonfig.Sources)
+	src.Update(nil, configDefaults, "default")
+	prev := configDefaults
+	for _, layer := range configLayers {
+		src.Update(prev, layer.Fields, "file "+layer.Path)
+		prev = layer.Fields
+	}
+	if name != "" {
+		src.Update(RawConfig.Fields(), c.Fields(), "profile "+name)
+	}
+	before := c.Fields()
+	env, err := c.Env(os.Environ())
+	if err != nil {
+		return err
+	}
+	src.Update(before, c.Fields(), "env")
+	for path, name := range env {
+		src[path] = "env " + name
+	}
+	before = c.Fields()
+	for _, set := range ConfigSets {
+		i := strings.Index(set, "=")
+		err := c.Set(set[:i], set[i+1:])
+		if err != nil {
+			return err
+		}
+	}
+	src.Update(before, c.Fields(), "flag -set")
+
+	ProfileName, Config, ConfigSources = name, c, src
+	return nil
+}
+
+// repeated -set flags
+type setFlags []string
+
+func (s *setFlags) String() string { return strings.Join(*s, " ") }
+
+func (s *setFlags) Set(v string) error {
+	if strings.Index(v, "=") < 1 {
+		return fmt.Errorf("expected path=value")
+	}
+	*s = append(*s, v)
+	return nil
+}
+
 func getargs(args []string, defcmd string, defargs ...string) (subcmd string, subargs []string) {
 	if len(args) == 0 {
 		return defcmd, defargs
@@ -0,0 +1,174 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// check.go [created: Mon, 19 Oct 2026]
+
+package oticonfig
+
+import (
+	"github.com/bmatsuo/oti/otitag"
+
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ec2 tag keys are limited to 127 characters
+const MaxTagKeyLength = 127
+
+// a problem with a configuration found by Check.
+type Problem struct {
+	Path    string // the config field (e.g. "Ec2.Regions[1].RegionName")
+	Message string
+	Warning bool // the configuration is usable but likely wrong
+}
+
+func (p Problem) Error() string {
+	return p.Path + ": " + p.Message
+}
+
+// validate c without contacting aws.  region names must be known (or custom),
+// regions configured more than once need an Id, the tag prefix must produce
+// valid tag keys, and the packer manifest directory must exist.
+func (c *C) Check() []Problem {
+	var ps []Problem
+	errorf := func(path, format string, v ...interface{}) {
+		ps = append(ps, Problem{Path: path, Message: fmt.Sprintf(format, v...)})
+	}
+	warnf := func(path, format string, v ...interface{}) {
+		ps = append(ps, Problem{Path: path, Message: fmt.Sprintf(format, v...), Warning: true})
+	}
+
+	if c.Ec2.DefaultRegion != "" {
+		if _, err := c.AwsRegion(c.Ec2.DefaultRegion); err != nil {
+			errorf("Ec2.DefaultRegion", "%v", err)
+		}
+	}
+
+	names := make(map[string]int)
+	ids := make(map[string]int)
+	for i, cr := range c.Ec2.Regions {
+		path := fmt.Sprintf("Ec2.Regions[%d]", i)
+		if cr.RegionName == "" {
+			errorf(path+".RegionName", "missing region name")
+		} else if _, err := c.AwsRegion(cr.RegionName); err != nil {
+			errorf(path+".RegionName", "%v", err)
+		}
+		names[cr.RegionName]++
+		if cr.Id != "" {
+			id := cr.RegionName + "/" + cr.Id
+			if j, ok := ids[id]; ok {
+				errorf(path+".Id", "duplicate id %q (see Ec2.Regions[%d])", id, j)
+			} else {
+				ids[id] = i
+			}
+		}
+		for j, sg := range cr.SecurityGroups {
+			sgpath := fmt.Sprintf("%s.SecurityGroups[%d]", path, j)
+			switch {
+			case sg == (Ec2SecurityGroup{}):
+				errorf(sgpath, "security group with neither Id or Name")
+			case sg.Id != "" && !strings.HasPrefix(sg.Id, "sg-"):
+				warnf(sgpath+".Id", "%q does not look like a security group id", sg.Id)
+			}
+		}
+		if cr.AssumeRole != nil && cr.AssumeRole.RoleArn == "" {
+			errorf(path+".AssumeRole.RoleArn", "missing role arn")
+		}
+	}
+	for i, cr := range c.Ec2.Regions {
+		n := names[cr.RegionName]
+		if cr.RegionName != "" && n > 1 && cr.Id == "" {
+			errorf(fmt.Sprintf("Ec2.Regions[%d].Id", i), "region %q is configured %d times; each needs an Id", cr.RegionName, n)
+		}
+	}
+
+	for i, cr := range c.Ec2.CustomRegions {
+		path := fmt.Sprintf("Ec2.CustomRegions[%d]", i)
+		if cr.Name == "" {
+			errorf(path+".Name", "missing region name")
+		}
+		for _, endpoint := range []struct{ name, url string }{
+			{"EC2Endpoint", cr.EC2Endpoint},
+			{"STSEndpoint", cr.STSEndpoint},
+		} {
+			if endpoint.url == "" {
+				if endpoint.name == "EC2Endpoint" {
+					errorf(path+".EC2Endpoint", "missing endpoint")
+				}
+				continue
+			}
+			u, err := url.Parse(endpoint.url)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				errorf(path+"."+endpoint.name, "invalid endpoint %q", endpoint.url)
+			}
+		}
+	}
+	if c.Ec2.OnlyCustomRegions && len(c.Ec2.CustomRegions) == 0 {
+		warnf("Ec2.OnlyCustomRegions", "no custom regions to scan")
+	}
+
+	prefix := c.Ec2.TagPrefix
+	switch {
+	case prefix == "":
+		warnf("Ec2.TagPrefix", "empty; oti tags may collide with other tools")
+	case strings.HasPrefix(strings.ToLower(prefix), "aws:"):
+		errorf("Ec2.TagPrefix", "the prefix \"aws:\" is reserved by aws")
+	case strings.TrimSpace(prefix) != prefix:
+		errorf("Ec2.TagPrefix", "leading or trailing space")
+	case !strings.ContainsAny(prefix[len(prefix)-1:], "./:-_"):
+		warnf("Ec2.TagPrefix", "%q does not end with a separator (e.g. %q)", prefix, prefix+".")
+	}
+	for _, tag := range otitag.AllTags() {
+		if key := c.Ec2Tag(tag); len(key) > MaxTagKeyLength {
+			errorf("Ec2.TagPrefix", "tag %q is longer than %d characters", key, MaxTagKeyLength)
+			break
+		}
+	}
+
+	if c.Images.NameTag == "" {
+		warnf("Images.NameTag", "empty; images can only be launched by id")
+	} else if c.Images.BuildDateTag == "" {
+		warnf("Images.BuildDateTag", "empty; images cannot be ordered by build date")
+	}
+
+	var lists []string
+	for name := range c.Images.AccountLists {
+		lists = append(lists, name)
+	}
+	sort.Strings(lists)
+	for _, name := range lists {
+		for _, id := range c.Images.AccountLists[name] {
+			if !IsAccountId(id) {
+				errorf("Images.AccountLists."+name, "invalid account id %q", id)
+			}
+		}
+	}
+	for _, a := range c.Images.ShareAccounts {
+		if _, ok := c.Images.AccountLists[a]; !ok && !IsAccountId(a) {
+			errorf("Images.ShareAccounts", "%q is neither an account id nor an account list", a)
+		}
+	}
+
+	if dir := c.Packer.ManifestDir; dir != "" {
+		info, err := os.Stat(dir)
+		switch {
+		case err != nil:
+			errorf("Packer.ManifestDir", "%v", err)
+		case !info.IsDir():
+			errorf("Packer.ManifestDir", "%s is not a directory", dir)
+		}
+	}
+
+	if c.AssumeRole != nil && c.AssumeRole.RoleArn == "" {
+		errorf("AssumeRole.RoleArn", "missing role arn")
+	}
+	if _, err := c.CredentialsChain(); err != nil {
+		errorf("Credentials.Sources", "%v", err)
+	}
+
+	return ps
+}
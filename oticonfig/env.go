@@ -0,0 +1,340 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// env.go [created: Mon, 19 Oct 2026]
+
+package oticonfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the prefix of environment variables overriding config fields
+const EnvPrefix = "OTI_"
+
+// a configuration field.  the elements of Ec2.Regions are named by their
+// RegionName and Id, and the elements of Ec2.CustomRegions by their Name, in
+// Path (e.g. "Ec2.Regions.us-east-1.KeyName" or
+// "Ec2.Regions.us-east-1/public.KeyName").  profiles are not fields.
+type Field struct {
+	Path  string // e.g. "Ec2.TagPrefix"
+	Env   string // the environment variable overriding the field
+	Value string // lists are comma separated, other structures are json
+
+	zero bool
+}
+
+// returns the environment variable overriding the field at path.
+//	Ec2.TagPrefix                    OTI_EC2_TAGPREFIX
+//	Ec2.Regions.us-east-1.KeyName    OTI_EC2_REGIONS_US_EAST_1_KEYNAME
+func EnvName(path string) string {
+	name := strings.Map(func(c rune) rune {
+		switch {
+		case 'a' <= c && c <= 'z':
+			return c - 'a' + 'A'
+		case 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+			return c
+		}
+		return '_'
+	}, path)
+	return EnvPrefix + name
+}
+
+// returns every field of c, including the fields of unset roles.
+func (c *C) Fields() []Field {
+	var fs []Field
+	walkFields(reflect.ValueOf(c).Elem(), "", &fs)
+	return fs
+}
+
+func walkFields(v reflect.Value, path string, fs *[]Field) {
+	switch {
+	case v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Struct:
+		if v.IsNil() {
+			v = reflect.New(v.Type().Elem())
+		}
+		walkFields(v.Elem(), path, fs)
+	case v.Kind() == reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath != "" || sf.Name == "Profiles" {
+				continue
+			}
+			walkFields(v.Field(i), joinPath(path, sf.Name), fs)
+		}
+	case isKeyedList(v.Type()):
+		for i := 0; i < v.Len(); i++ {
+			walkFields(v.Index(i), joinPath(path, elemKey(v.Index(i))), fs)
+		}
+	default:
+		*fs = append(*fs, Field{Path: path, Env: EnvName(path), Value: formatField(v), zero: v.IsZero()})
+	}
+}
+
+// set the field at path (matched without regard to case) to value.  a
+// missing element of Ec2.Regions or Ec2.CustomRegions is created.
+func (c *C) Set(path, value string) error {
+	v := reflect.ValueOf(c).Elem()
+	for _, name := range splitPath(path) {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		switch {
+		case v.Kind() == reflect.Struct:
+			f := v.FieldByNameFunc(func(n string) bool {
+				return strings.EqualFold(n, name) && n != "Profiles"
+			})
+			if !f.IsValid() {
+				return fmt.Errorf("%s: unknown field %q", path, name)
+			}
+			v = f
+		case isKeyedList(v.Type()):
+			v = keyedElem(v, name)
+		default:
+			return fmt.Errorf("%s: %q has no fields", path, name)
+		}
+	}
+	err := parseField(v, value)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// apply OTI_* variables in environ (formatted as by os.Environ) to c.  the
+// path of each field set is mapped to the name of its variable.  variables
+// naming a region missing from c.Ec2.Regions or c.Ec2.CustomRegions add the
+// region (e.g. OTI_EC2_REGIONS_EU_WEST_1_KEYNAME).
+func (c *C) Env(environ []string) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, EnvPrefix) {
+			i := strings.Index(kv, "=")
+			if i > 0 {
+				env[kv[:i]] = kv[i+1:]
+			}
+		}
+	}
+
+	applied := make(map[string]string)
+	set := func(path, name string) error {
+		err := c.Set(path, env[name])
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		applied[path] = name
+		delete(env, name)
+		return nil
+	}
+
+	for _, f := range c.Fields() {
+		if _, ok := env[f.Env]; ok {
+			err := set(f.Path, f.Env)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// remaining variables may name new list elements.  they are applied in
+	// order so the result does not depend on the environment's order.
+	var names []string
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lists := []struct {
+		path string
+		elem interface{}
+	}{
+		{"Ec2.Regions", Ec2Region{}},
+		{"Ec2.CustomRegions", Ec2CustomRegion{}},
+	}
+	for _, name := range names {
+		for _, list := range lists {
+			prefix := EnvName(list.path) + "_"
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			rest := strings.TrimPrefix(name, prefix)
+			path, err := elemFieldPath(list.elem, rest)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			err = set(joinPath(list.path, path), name)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return applied, nil
+}
+
+// the source of each configuration value by field path (e.g. "default",
+// "file oti.json", "env OTI_EC2_TAGPREFIX").
+type Sources map[string]string
+
+// records source for each field of after with a value different from the
+// field in before.  fields missing from before are recorded if they are set.
+func (s Sources) Update(before, after []Field, source string) {
+	values := make(map[string]string, len(before))
+	for _, f := range before {
+		values[f.Path] = f.Value
+	}
+	for _, f := range after {
+		v, ok := values[f.Path]
+		if ok && v != f.Value || !ok && !f.zero {
+			s[f.Path] = source
+		}
+	}
+}
+
+// returns the path, relative to a list, of the element field named by env, the
+// remainder of an environment variable (e.g. "EU_WEST_1_KEYNAME" is
+// "eu-west-1.KeyName").
+func elemFieldPath(elem interface{}, env string) (string, error) {
+	var fs []Field
+	walkFields(reflect.ValueOf(elem), "", &fs)
+	// longer field names are matched first.
+	sort.Slice(fs, func(i, j int) bool { return len(fs[i].Env) > len(fs[j].Env) })
+	for _, f := range fs {
+		suffix := "_" + strings.TrimPrefix(f.Env, EnvPrefix)
+		if strings.HasSuffix(env, suffix) && len(env) > len(suffix) {
+			key := strings.TrimSuffix(env, suffix)
+			key = strings.ToLower(strings.Replace(key, "_", "-", -1))
+			return joinPath(key, f.Path), nil
+		}
+	}
+	return "", fmt.Errorf("unknown field")
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// split path into field names.  list element keys cannot contain dots.
+func splitPath(path string) []string {
+	return strings.Split(path, ".")
+}
+
+// region lists are keyed by their elements (see elemKey).  other lists are
+// single fields.
+func isKeyedList(t reflect.Type) bool {
+	return t == reflect.TypeOf([]Ec2Region(nil)) || t == reflect.TypeOf([]Ec2CustomRegion(nil))
+}
+
+// the key of a region profile.  profiles of different regions may share an
+// Id so the Id alone is not a key.
+func regionKey(regionName, id string) string {
+	if id == "" {
+		return regionName
+	}
+	return regionName + "/" + id
+}
+
+func elemKey(v reflect.Value) string {
+	switch elem := v.Interface().(type) {
+	case Ec2Region:
+		return regionKey(elem.RegionName, elem.Id)
+	case Ec2CustomRegion:
+		return elem.Name
+	}
+	return ""
+}
+
+// returns the element of list v with the given key, appending a new element
+// if none exists.
+func keyedElem(v reflect.Value, key string) reflect.Value {
+	for i := 0; i < v.Len(); i++ {
+		if strings.EqualFold(elemKey(v.Index(i)), key) {
+			return v.Index(i)
+		}
+	}
+	elem := reflect.New(v.Type().Elem()).Elem()
+	switch e := elem.Addr().Interface().(type) {
+	case *Ec2Region:
+		e.RegionName = key
+		if i := strings.Index(key, "/"); i >= 0 {
+			e.RegionName, e.Id = key[:i], key[i+1:]
+		}
+	case *Ec2CustomRegion:
+		e.Name = key
+	}
+	v.Set(reflect.Append(v, elem))
+	return v.Index(v.Len() - 1)
+}
+
+func formatField(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			return strings.Join(v.Interface().([]string), ",")
+		}
+	}
+	if v.Kind() == reflect.Slice && v.Len() == 0 {
+		return ""
+	}
+	p, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Sprint(v.Interface())
+	}
+	return string(p)
+}
+
+func parseField(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			var list []string
+			if value != "" {
+				list = strings.Split(value, ",")
+			}
+			v.Set(reflect.ValueOf(list))
+			return nil
+		}
+	}
+	ptr := reflect.New(v.Type())
+	err := json.Unmarshal([]byte(value), ptr.Interface())
+	if err != nil {
+		return err
+	}
+	v.Set(ptr.Elem())
+	return nil
+}
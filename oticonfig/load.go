@@ -0,0 +1,427 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// load.go [created: Mon, 19 Oct 2026]
+
+package oticonfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// the name of configuration files found by SearchPaths
+const FileName = "oti.json"
+
+// returns the existing configuration files, lowest precedence first.
+//	<repo>/oti.json                 the nearest directory containing .git
+//	./oti.json
+//	$XDG_CONFIG_HOME/oti/oti.json   $XDG_CONFIG_HOME defaults to ~/.config
+// a team configuration can be checked into a repository and overridden by a
+// personal configuration.
+func SearchPaths() []string {
+	var candidates []string
+	wd, err := os.Getwd()
+	if err == nil {
+		if root := repoRoot(wd); root != "" {
+			candidates = append(candidates, filepath.Join(root, FileName))
+		}
+		candidates = append(candidates, filepath.Join(wd, FileName))
+	}
+	if dir := userConfigDir(); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "oti", FileName))
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	for _, path := range candidates {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func repoRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func userConfigDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".config")
+	}
+	return ""
+}
+
+// the configuration after a file was merged.  see Load.
+type Layer struct {
+	Path   string
+	Fields []Field
+}
+
+// read the files at paths, lowest precedence first, and merge them over c.
+// each file may list other files in an "Include" key (a string or a list of
+// strings, relative to the file).  included files are merged before the file
+// including them.  relative paths in a file (see pathFields) are relative to
+// the file's directory.
+//
+// objects are merged key by key.  elements of Ec2.Regions and
+// Ec2.CustomRegions are merged with the element having the same Id,
+// RegionName or Name, or appended.  security groups are added to a region's
+// groups.  any other value replaces the value beneath it.
+//
+// a layer is returned for each file merged.  keys that are not config fields
+// are reported as warnings.
+func Load(paths []string, c *C) ([]Layer, []string, error) {
+	l := &loader{
+		base:    c.clone(),
+		tree:    make(map[string]interface{}),
+		loading: make(map[string]bool),
+	}
+	for _, path := range paths {
+		err := l.load(path)
+		if err != nil {
+			return l.layers, l.warnings, err
+		}
+	}
+	if len(l.layers) > 0 {
+		err := l.decode(c)
+		if err != nil {
+			return l.layers, l.warnings, err
+		}
+	}
+	return l.layers, l.warnings, nil
+}
+
+type loader struct {
+	base     C
+	tree     map[string]interface{}
+	loading  map[string]bool
+	layers   []Layer
+	warnings []string
+}
+
+func (l *loader) load(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if l.loading[abs] {
+		return fmt.Errorf("%s: include cycle", path)
+	}
+	l.loading[abs] = true
+	defer delete(l.loading, abs)
+
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var obj map[string]interface{}
+	err = json.Unmarshal(p, &obj)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	rebasePaths(obj, filepath.Dir(abs))
+	includes, err := includePaths(path, obj)
+	if err != nil {
+		return err
+	}
+	for _, inc := range includes {
+		err := l.load(inc)
+		if err != nil {
+			return err
+		}
+	}
+
+	warnings := unknownKeys(path, "", obj, reflect.TypeOf(C{}))
+	sort.Strings(warnings)
+	l.warnings = append(l.warnings, warnings...)
+	mergeValue(l.tree, obj, reflect.TypeOf(C{}))
+
+	var c C
+	err = l.decode(&c)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	l.layers = append(l.layers, Layer{Path: path, Fields: c.Fields()})
+	return nil
+}
+
+// decode the merged files over a copy of the base configuration.
+func (l *loader) decode(c *C) error {
+	p, err := json.Marshal(l.tree)
+	if err != nil {
+		return err
+	}
+	_c := l.base.clone()
+	err = json.Unmarshal(p, &_c)
+	if err != nil {
+		return err
+	}
+	*c = _c
+	return nil
+}
+
+// removes the Include key from obj and returns the paths it lists.
+func includePaths(path string, obj map[string]interface{}) ([]string, error) {
+	var incs []interface{}
+	for k, v := range obj {
+		if !strings.EqualFold(k, "Include") {
+			continue
+		}
+		delete(obj, k)
+		switch v := v.(type) {
+		case string:
+			incs = append(incs, v)
+		case []interface{}:
+			incs = append(incs, v...)
+		default:
+			return nil, fmt.Errorf("%s: Include must be a string or list of strings", path)
+		}
+	}
+
+	var paths []string
+	for _, inc := range incs {
+		s, ok := inc.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: Include must be a string or list of strings", path)
+		}
+		if !filepath.IsAbs(s) {
+			s = filepath.Join(filepath.Dir(path), s)
+		}
+		paths = append(paths, s)
+	}
+	return paths, nil
+}
+
+// fields holding file system paths, relative to C or a Profile.  relative
+// paths in a file are relative to the directory containing the file.
+var pathFields = [][]string{
+	{"AwsKeyPath"},
+	{"JournalDir"},
+	{"Packer", "ManifestDir"},
+	{"Credentials", "SharedCredentialsPath"},
+	{"Credentials", "SharedConfigPath"},
+}
+
+// makes the relative paths in obj, a decoded file, and its profiles relative
+// to dir.
+func rebasePaths(obj map[string]interface{}, dir string) {
+	objs := []map[string]interface{}{obj}
+	if profiles, ok := lookupKey(obj, "Profiles").(map[string]interface{}); ok {
+		for _, p := range profiles {
+			if p, ok := p.(map[string]interface{}); ok {
+				objs = append(objs, p)
+			}
+		}
+	}
+	for _, obj := range objs {
+		for _, field := range pathFields {
+			parent := obj
+			for _, k := range field[:len(field)-1] {
+				parent, _ = lookupKey(parent, k).(map[string]interface{})
+			}
+			for k, v := range parent {
+				s, ok := v.(string)
+				if ok && s != "" && !filepath.IsAbs(s) && strings.EqualFold(k, field[len(field)-1]) {
+					parent[k] = filepath.Join(dir, s)
+				}
+			}
+		}
+	}
+}
+
+// the value of key in obj, matched as encoding/json would.
+func lookupKey(obj map[string]interface{}, key string) interface{} {
+	for k, v := range obj {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+// returns the struct field of t matching key as encoding/json would.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath == "" && strings.EqualFold(f.Name, key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// merges src, a decoded json value of type t, into dst.
+func mergeValue(dst, src interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch dst := dst.(type) {
+	case map[string]interface{}:
+		src, ok := src.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for k, v := range src {
+			var elem reflect.Type
+			switch t.Kind() {
+			case reflect.Struct:
+				f, ok := jsonField(t, k)
+				if !ok {
+					continue
+				}
+				elem = f.Type
+			case reflect.Map:
+				elem = t.Elem()
+			default:
+				continue
+			}
+			dk := k
+			for _k := range dst {
+				if strings.EqualFold(_k, k) {
+					dk = _k
+				}
+			}
+			if d, ok := dst[dk]; ok {
+				dst[dk] = mergeValue(d, v, elem)
+			} else {
+				dst[dk] = v
+			}
+		}
+		return dst
+	case []interface{}:
+		src, ok := src.([]interface{})
+		if !ok {
+			break
+		}
+		switch t {
+		case reflect.TypeOf([]Ec2Region(nil)), reflect.TypeOf([]Ec2CustomRegion(nil)):
+			return mergeKeyed(dst, src, t.Elem())
+		case reflect.TypeOf([]Ec2SecurityGroup(nil)):
+			return mergeUnion(dst, src)
+		}
+	}
+	return src
+}
+
+// merges elements of src into the element of dst with the same key.
+func mergeKeyed(dst, src []interface{}, t reflect.Type) []interface{} {
+	for _, v := range src {
+		i := keyIndex(dst, jsonKey(v, t), t)
+		if i < 0 {
+			dst = append(dst, v)
+		} else {
+			dst[i] = mergeValue(dst[i], v, t)
+		}
+	}
+	return dst
+}
+
+// adds elements of src not already in dst.
+func mergeUnion(dst, src []interface{}) []interface{} {
+	for _, v := range src {
+		if !containsValue(dst, v) {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
+
+// the key of v, a decoded element of a list of type t elements.  see elemKey.
+func jsonKey(v interface{}, t reflect.Type) string {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _ := lookupKey(obj, "Name").(string)
+	regionName, _ := lookupKey(obj, "RegionName").(string)
+	id, _ := lookupKey(obj, "Id").(string)
+	switch t {
+	case reflect.TypeOf(Ec2Region{}):
+		if regionName == "" {
+			return ""
+		}
+		return regionKey(regionName, id)
+	case reflect.TypeOf(Ec2CustomRegion{}):
+		return name
+	}
+	return ""
+}
+
+func keyIndex(vs []interface{}, key string, t reflect.Type) int {
+	if key == "" {
+		return -1
+	}
+	for i := range vs {
+		if jsonKey(vs[i], t) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsValue(vs []interface{}, v interface{}) bool {
+	for i := range vs {
+		if reflect.DeepEqual(vs[i], v) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns warnings for keys in v, a decoded json value, that are not fields of
+// type t.
+func unknownKeys(file, path string, v interface{}, t reflect.Type) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var warnings []string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, _v := range v {
+			switch t.Kind() {
+			case reflect.Struct:
+				f, ok := jsonField(t, k)
+				if !ok {
+					warnings = append(warnings, fmt.Sprintf("%s: unknown key %q", file, joinPath(path, k)))
+					continue
+				}
+				warnings = append(warnings, unknownKeys(file, joinPath(path, f.Name), _v, f.Type)...)
+			case reflect.Map:
+				warnings = append(warnings, unknownKeys(file, joinPath(path, k), _v, t.Elem())...)
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice {
+			for i := range v {
+				warnings = append(warnings, unknownKeys(file, fmt.Sprintf("%s[%d]", path, i), v[i], t.Elem())...)
+			}
+		}
+	}
+	return warnings
+}
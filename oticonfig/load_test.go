@@ -0,0 +1,115 @@
+package oticonfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRelativePaths(t *testing.T) {
+	dir := t.TempDir()
+	err := os.Mkdir(filepath.Join(dir, "shared"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"oti.json": `{
+			"Include": "shared/oti.json",
+			"AwsKeyPath": "keys/aws_credentials.json",
+			"Profiles": {
+				"staging": {"Credentials": {"SharedCredentialsPath": "staging/credentials"}}
+			}
+		}`,
+		"shared/oti.json": `{
+			"JournalDir": "journals",
+			"Packer": {"ManifestDir": "packer"},
+			"Credentials": {"SharedConfigPath": "/etc/aws/config"}
+		}`,
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &C{AwsKeyPath: "aws_credentials.json"}
+	_, _, err = Load([]string{filepath.Join(dir, "oti.json")}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		field, path, expect string
+	}{
+		{"AwsKeyPath", c.AwsKeyPath, filepath.Join(dir, "keys/aws_credentials.json")},
+		{"JournalDir", c.JournalDir, filepath.Join(dir, "shared/journals")},
+		{"Packer.ManifestDir", c.Packer.ManifestDir, filepath.Join(dir, "shared/packer")},
+		{"Credentials.SharedConfigPath", c.Credentials.SharedConfigPath, "/etc/aws/config"},
+		{"Profiles.staging.Credentials.SharedCredentialsPath",
+			c.Profiles["staging"].Credentials.SharedCredentialsPath, filepath.Join(dir, "staging/credentials")},
+	} {
+		if test.path != test.expect {
+			t.Errorf("%s: %q (expected %q)", test.field, test.path, test.expect)
+		}
+	}
+}
+
+func TestLoadRegionProfiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.json": `{"Ec2": {
+			"Regions": [
+				{"RegionName": "us-east-1", "Id": "public", "KeyName": "east"},
+				{"RegionName": "us-west-2", "KeyName": "west"}
+			],
+			"CustomRegions": [{"Name": "local", "EC2Endpoint": "http://localhost:5000/"}]
+		}}`,
+		"oti.json": `{"Include": "base.json", "Ec2": {
+			"Regions": [
+				{"RegionName": "us-west-2", "Id": "public", "KeyName": "west-public"},
+				{"RegionName": "us-east-1", "Id": "public", "SecurityGroups": [{"Name": "web"}]}
+			],
+			"CustomRegions": [{"Name": "local", "EC2Endpoint": "http://localhost:5001/"}]
+		}}`,
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &C{}
+	_, _, err := Load([]string{filepath.Join(dir, "oti.json")}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, r := range c.Ec2.Regions {
+		keys = append(keys, r.RegionName+"/"+r.Id+"/"+r.KeyName+"/"+fmt.Sprint(len(r.SecurityGroups)))
+	}
+	expect := "[us-east-1/public/east/1 us-west-2//west/0 us-west-2/public/west-public/0]"
+	if fmt.Sprint(keys) != expect {
+		t.Errorf("regions %v (expected %s)", keys, expect)
+	}
+	if len(c.Ec2.CustomRegions) != 1 || c.Ec2.CustomRegions[0].EC2Endpoint != "http://localhost:5001/" {
+		t.Errorf("custom regions %+v", c.Ec2.CustomRegions)
+	}
+
+	err = c.Set("Ec2.Regions.us-west-2/public.KeyName", "set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Set("Ec2.Regions.eu-west-1/public.KeyName", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Ec2.Regions[2].KeyName != "set" || c.Ec2.Regions[0].KeyName != "east" {
+		t.Errorf("set the wrong region: %+v", c.Ec2.Regions)
+	}
+	if r := c.Ec2.Regions[len(c.Ec2.Regions)-1]; r.RegionName != "eu-west-1" || r.Id != "public" || r.KeyName != "new" {
+		t.Errorf("new region %+v", r)
+	}
+}
@@ -16,22 +16,111 @@ permissions on the file).
 
 	{ "AccessKey": "xxxxxxxxxxxx", "SecretKey": "yyyyyyyyyyyy", }
 
-see the AwsKey type for details
+see the AwsKey type for details.  credentials can also come from environment
+variables, the aws cli shared credentials files, or the ec2 instance metadata
+service.  see the Credentials type.
 
 
 Configuration file
 
 
 a configuration file can make repeated use much easier. create a file
-containing a json object. by default, oti looks for a file called oti.json.
+containing a json object. by default, oti reads every file called oti.json in
+the following locations, later files overriding earlier ones.
+
+	the root of the git repository containing the working directory
+	the working directory
+	$XDG_CONFIG_HOME/oti (~/.config/oti by default)
+
+so a team configuration can be checked into a repository and overridden by a
+personal one.  the oti -c option names a single file instead.  a file can
+include others, which it overrides.  relative paths in a file, such as
+AwsKeyPath and Packer.ManifestDir, are relative to the file's directory.
+
+	{ "Include": ["../shared/oti.json"], "Ec2": { "TagPrefix": "com.example." } }
+
+files are merged object by object.  regions in Ec2.Regions are merged by
+RegionName and Id, custom regions by Name, and the security groups of merged
+regions are combined.  other lists replace lists in earlier files.  unknown keys produce warnings.  see Load.
 
 see the C type for details on the configuration format.
 
+
+Profiles
+
+a configuration can define named profiles for different accounts, each with
+its own credentials, tag prefix, image tags and regions.
+
+	{
+		"AwsKeyPath": "dev_credentials.json",
+		"Profiles": {
+			"staging": {
+				"AwsKeyPath": "staging_credentials.json",
+				"Ec2": { "TagPrefix": "com.example.staging." }
+			}
+		}
+	}
+
+the oti -profile option (or the OTI_PROFILE environment variable) selects a
+profile.  see the Profile type for details.
+
+
+Assuming roles
+
+a configuration, profile or region can name an iam role for oti to assume.
+oti requests temporary credentials for the role using the credentials it
+located and refreshes them as they expire.
+
+	{
+		"AssumeRole": {
+			"RoleArn": "arn:aws:iam::123456789012:role/oti-launch",
+			"ExternalId": "xxxxxxxx",
+			"SessionName": "ci"
+		}
+	}
+
+the Endpoint option of AssumeRole can point at a local sts stand-in for
+testing.  see the AssumeRole type for details.
+
+
+Custom regions
+
+regions unknown to goamz, such as private regions or a local ec2 emulator, can
+be given explicit endpoints.  custom regions can be used anywhere a region name
+is accepted and are included when oti scans all regions.
+
+	{
+		"Ec2": {
+			"CustomRegions": [
+				{ "Name": "local", "EC2Endpoint": "http://localhost:5000/" }
+			],
+			"OnlyCustomRegions": true
+		}
+	}
+
+with OnlyCustomRegions oti never contacts aws while scanning regions, so the
+whole workflow can run against an emulator.  see the Ec2CustomRegion type.
+
+
+Environment
+
+every field can be overridden by an environment variable named after its path
+(see EnvName and the Fields method).
+
+	OTI_EC2_TAGPREFIX=com.example.
+	OTI_EC2_DEFAULTREGION=us-west-2
+	OTI_EC2_REGIONS_US_WEST_2_KEYNAME=deploy
+
+values are taken from the first of command flags, environment variables, the
+configuration file and defaults.  `oti config show` prints each value and its
+source.
+
 */
 package oticonfig
 
 import (
 	"github.com/bmatsuo/go-jsontree"
+	"github.com/bmatsuo/oti/oticreds"
 	"github.com/bmatsuo/oti/otitag"
 	"github.com/crowdmob/goamz/aws"
 	awsec2 "github.com/crowdmob/goamz/ec2"
@@ -39,8 +128,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 )
 
 // the json configuration for oti
@@ -54,8 +147,53 @@ type C struct {
 	// see func (c *C) AwsKey()
 	AwsKeyPath string `json:",omitempty"`
 
+	// where to look for aws credentials. see func (c *C) AwsCredentials()
+	Credentials Credentials `json:",omitempty"`
+
+	// a role to assume for all regions. see func (c *C) RegionCredentials()
+	AssumeRole *AssumeRole `json:",omitempty"`
+
+	// see func (c *C) SessionJournalDir()
+	JournalDir string `json:",omitempty"`
+
 	// default Ec2 deployment configurations
 	Ec2 Ec2 `json:",omitempty"`
+
+	// defaults for the instances command
+	Instances Instances `json:",omitempty"`
+
+	// named profiles for working with multiple accounts.  the fields above
+	// make up the default profile.  see func (c *C) Profile(string)
+	Profiles map[string]*Profile `json:",omitempty"`
+}
+
+// a named set of account specific configuration.  empty fields are inherited
+// from the top level configuration.
+type Profile struct {
+	// see C.AwsKeyPath
+	AwsKeyPath string `json:",omitempty"`
+
+	// each empty field is inherited
+	Credentials Credentials `json:",omitempty"`
+
+	// inherited if nil
+	AssumeRole *AssumeRole `json:",omitempty"`
+
+	// image options.  each empty field is inherited
+	Images Images `json:",omitempty"`
+
+	// each empty field is inherited.  a false OnlyCustomRegions is inherited
+	// and Regions replaces the inherited regions when given.
+	Ec2 Ec2 `json:",omitempty"`
+}
+
+type Instances struct {
+	// columns listed by default (e.g. ["InstanceId", "ImageId", "tag:Name"]).
+	// see `oti instances -h`
+	Columns []string `json:",omitempty"`
+
+	// column instances are sorted by. a leading "-" reverses the order
+	SortBy string `json:",omitempty"`
 }
 
 type Packer struct {
@@ -71,21 +209,64 @@ type Images struct {
 	// tag identifying the date an image was created
 	BuildDateTag string `json:",omitempty"`
 
-	// tag containing a semantic version for the image
-	VersionTag string `json:",omitempty"` // not used
+	// tag containing a semantic version for the image.  see the version
+	// directive of `oti launch`.
+	VersionTag string `json:",omitempty"`
+
+	// tag listing the release channels of an image (e.g. "staging,stable").
+	// see `oti images promote` and the channel directive of `oti launch`.
+	ChannelTag string `json:",omitempty"`
+
+	// named lists of aws account ids images may be shared with (e.g.
+	// {"partners": ["123456789012"]}).  see `oti images share`.
+	AccountLists map[string][]string `json:",omitempty"`
+
+	// account ids or names of AccountLists images are shared with when no
+	// accounts are given to `oti images share`.
+	ShareAccounts []string `json:",omitempty"`
+
+	// the default strategy selecting among images with a name (e.g.
+	// "latest", "version").  see the select directive of `oti launch`.
+	Strategy string `json:",omitempty"`
 }
 
 type Ec2 struct {
 	// see func (c *C) Ec2Tag(otitag.OTITag)
 	TagPrefix string `json:",omitempty"`
 
+	// the region used by commands when none is given (e.g. "us-east-1")
+	DefaultRegion string `json:",omitempty"`
+
 	// region specific configuration
 	Regions []Ec2Region
+
+	// regions missing from goamz's region table, such as private regions or
+	// local emulators. see func (c *C) AwsRegion(string)
+	CustomRegions []Ec2CustomRegion `json:",omitempty"`
+
+	// commands that scan every region (e.g. "oti sessions") scan only
+	// CustomRegions.  useful when no aws account is available.
+	OnlyCustomRegions bool `json:",omitempty"`
+}
+
+// a region with explicit endpoints.  a custom region may replace a region
+// known to goamz.
+type Ec2CustomRegion struct {
+	// the region name given to oti (e.g. with "oti launch -r"). required
+	Name string
+
+	// the url of the ec2 api (e.g. "http://localhost:5000/"). required
+	EC2Endpoint string
+
+	// the url of the sts api used to assume roles in the region.  the
+	// default is AssumeRole.Endpoint
+	STSEndpoint string `json:",omitempty"`
 }
 
 type Ec2Region struct {
 	// a unique identifier for the object. required if more than one region
-	// profile is defined for the same RegionName.
+	// profile is defined for the same RegionName.  see `oti launch
+	// -region-profile`
 	Id string `json:",omitempty"`
 
 	// an ec2 canonical region name (e.g. "us-east-1"). required
@@ -96,25 +277,155 @@ type Ec2Region struct {
 
 	// security groups. additional groups can be added per instance.
 	SecurityGroups []Ec2SecurityGroup `json:",omitempty"`
+
+	// a role to assume in the region. overrides C.AssumeRole
+	AssumeRole *AssumeRole `json:",omitempty"`
+}
+
+// an iam role assumed through sts.  oti uses the temporary credentials of the
+// role in place of the credentials it locates (see Credentials), and tags
+// launched instances with the assumed role's arn.
+type AssumeRole struct {
+	// the role to assume. required
+	RoleArn string
+
+	// an external id required by the role's trust policy
+	ExternalId string `json:",omitempty"`
+
+	// the role session name. the default is "oti"
+	SessionName string `json:",omitempty"`
+
+	// the lifetime of the credentials. the default is 3600
+	DurationSeconds int `json:",omitempty"`
+
+	// the sts endpoint and the region used to sign requests. the defaults
+	// are oticreds.STSEndpoint and "us-east-1"
+	Endpoint string `json:",omitempty"`
+	Region   string `json:",omitempty"`
+}
+
+// the sources of aws credentials.  see package oticreds for a description of
+// each source.
+type Credentials struct {
+	// credential sources tried in order. the default order is
+	//	["env", "file", "shared", "metadata"]
+	// where "file" refers to C.AwsKeyPath.
+	Sources []string `json:",omitempty"`
+
+	// the profile in the shared credentials files. the default is the value
+	// of AWS_PROFILE or "default"
+	SharedProfile string `json:",omitempty"`
+
+	// the shared credentials files. the defaults are ~/.aws/credentials and
+	// ~/.aws/config
+	SharedCredentialsPath string `json:",omitempty"`
+	SharedConfigPath      string `json:",omitempty"`
+
+	// the instance metadata service. the default is oticreds.MetadataEndpoint
+	MetadataEndpoint string `json:",omitempty"`
 }
 
+// the default credential sources
+var CredentialSources = []string{"env", "file", "shared", "metadata"}
+
 // security groups with neither Id or Name are ignored.
 type Ec2SecurityGroup struct {
 	Id   string `json:",omitempty"`
 	Name string `json:",omitempty"`
 }
 
-// unmarshal json data stored at path into c. any error encountered is returned.
+// unmarshal json data stored at path into c, along with any files it
+// includes. any error encountered is returned.  see Load.
 func Read(path string, c *C) error {
-	configp, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
+	_, _, err := Load([]string{path}, c)
+	return err
+}
+
+// returns the configuration for the named profile, c with the profile's
+// fields overriding its own.  the empty name refers to the default profile,
+// c itself.  the returned configuration has no profiles and shares no data
+// with c, so it may be modified (e.g. with Set).
+func (c *C) Profile(name string) (*C, error) {
+	_c := c.clone()
+	_c.Profiles = nil
+	if name == "" {
+		return &_c, nil
 	}
-	err = json.Unmarshal(configp, c)
-	if err != nil {
-		return err
+
+	p := c.Profiles[name]
+	if p == nil {
+		return nil, fmt.Errorf("no profile %q", name)
 	}
-	return nil
+	if p.AwsKeyPath != "" {
+		_c.AwsKeyPath = p.AwsKeyPath
+	}
+	overrideFields(&_c.Credentials, &p.Credentials)
+	if p.AssumeRole != nil {
+		_c.AssumeRole = p.AssumeRole
+	}
+	overrideFields(&_c.Images, &p.Images)
+	overrideFields(&_c.Ec2, &p.Ec2)
+	_c = _c.clone()
+	return &_c, nil
+}
+
+// set each field of the struct dst points to from the same field of the
+// struct src points to, unless the src field is empty (a zero value or an
+// empty list or map).
+func overrideFields(dst, src interface{}) {
+	d, s := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for i := 0; i < s.NumField(); i++ {
+		f := s.Field(i)
+		switch f.Kind() {
+		case reflect.Slice, reflect.Map:
+			if f.Len() == 0 {
+				continue
+			}
+		default:
+			if f.IsZero() {
+				continue
+			}
+		}
+		d.Field(i).Set(f)
+	}
+}
+
+// a copy of c with its region lists and roles copied.
+func (c *C) clone() C {
+	_c := *c
+	_c.AssumeRole = c.AssumeRole.clone()
+	_c.Ec2.Regions = append([]Ec2Region(nil), c.Ec2.Regions...)
+	for i := range _c.Ec2.Regions {
+		_c.Ec2.Regions[i].AssumeRole = _c.Ec2.Regions[i].AssumeRole.clone()
+	}
+	_c.Ec2.CustomRegions = append([]Ec2CustomRegion(nil), c.Ec2.CustomRegions...)
+	if c.Images.AccountLists != nil {
+		_c.Images.AccountLists = make(map[string][]string, len(c.Images.AccountLists))
+		for name, ids := range c.Images.AccountLists {
+			_c.Images.AccountLists[name] = append([]string(nil), ids...)
+		}
+	}
+	_c.Images.ShareAccounts = append([]string(nil), c.Images.ShareAccounts...)
+	return _c
+}
+
+func (r *AssumeRole) clone() *AssumeRole {
+	if r == nil {
+		return nil
+	}
+	_r := *r
+	return &_r
+}
+
+// returns the names of all profiles, sorted, beginning with the default
+// profile "".
+func (c *C) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles)+1)
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{""}, names...)
 }
 
 // returns name prefixed with c.TagPrefix
@@ -122,69 +433,274 @@ func (c *C) Ec2Tag(tag otitag.OTITag) string {
 	return c.Ec2.TagPrefix + string(tag)
 }
 
-// returns the first region config with RegionName equal to r.Name
-func (c *C) Ec2Region(r aws.Region) *Ec2Region {
-	for _, cr := range c.Ec2.Regions {
-		if cr.RegionName == r.Name {
+// returns the region with the given name.  regions in c.Ec2.CustomRegions
+// take precedence over those known to goamz.
+func (c *C) AwsRegion(name string) (aws.Region, error) {
+	for _, cr := range c.Ec2.CustomRegions {
+		if cr.Name == name {
+			return cr.AwsRegion(), nil
+		}
+	}
+	r := aws.Regions[name]
+	if r.Name == "" {
+		return aws.Region{}, fmt.Errorf("unknown ec2 region %q", name)
+	}
+	return r, nil
+}
+
+// returns the regions in c.Ec2.CustomRegions
+func (c *C) CustomAwsRegions() []aws.Region {
+	rs := make([]aws.Region, 0, len(c.Ec2.CustomRegions))
+	for _, cr := range c.Ec2.CustomRegions {
+		rs = append(rs, cr.AwsRegion())
+	}
+	return rs
+}
+
+// returns the custom region config named r.Name, or nil.
+func (c *C) Ec2CustomRegion(r aws.Region) *Ec2CustomRegion {
+	for _, cr := range c.Ec2.CustomRegions {
+		if cr.Name == r.Name {
 			return &cr
 		}
 	}
 	return nil
 }
 
-// BUG uses the first region config with right name
-func (c *C) Ec2KeyName(r aws.Region) string {
-	cr := c.Ec2Region(r)
-	if cr == nil {
-		return ""
+func (cr Ec2CustomRegion) AwsRegion() aws.Region {
+	return aws.Region{
+		Name:        cr.Name,
+		EC2Endpoint: cr.EC2Endpoint,
+	}
+}
+
+// returns the region profile in r with the given id.  the id may be
+// qualified with the region name (e.g. "us-east-1/public").  if id is empty
+// the only profile in r is returned and an error if there is more than one.
+// nil is returned if r has no profiles and id is empty.
+func (c *C) Ec2Region(r aws.Region, id string) (*Ec2Region, error) {
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		if id[:i] != r.Name {
+			return nil, fmt.Errorf("region profile %q is not in region %s", id, r.Name)
+		}
+		id = id[i+1:]
+	}
+
+	var crs []*Ec2Region
+	var ids []string
+	for i := range c.Ec2.Regions {
+		cr := &c.Ec2.Regions[i]
+		if cr.RegionName != r.Name {
+			continue
+		}
+		ids = append(ids, cr.Id)
+		if id == "" || cr.Id == id {
+			crs = append(crs, cr)
+		}
 	}
 
-	return cr.KeyName
+	switch {
+	case len(crs) == 1:
+		return crs[0], nil
+	case len(crs) == 0 && id == "":
+		return nil, nil
+	case len(crs) == 0:
+		return nil, fmt.Errorf("no region profile %q in %s", id, r.Name)
+	case id == "":
+		return nil, fmt.Errorf("region %s has %d profiles %q; select one by id", r.Name, len(crs), ids)
+	default:
+		return nil, fmt.Errorf("region %s has %d profiles with id %q", r.Name, len(crs), id)
+	}
 }
 
-// BUG uses the first region config with right name
-func (c *C) Ec2SecurityGroups(r aws.Region) []awsec2.SecurityGroup {
-	cr := c.Ec2Region(r)
+// returns the key name of the region profile in r with the given id.  see
+// func (c *C) Ec2Region(aws.Region, string)
+func (c *C) Ec2KeyName(r aws.Region, id string) (string, error) {
+	cr, err := c.Ec2Region(r, id)
 	if cr == nil {
-		return nil
+		return "", err
 	}
 
-	n := len(cr.SecurityGroups)
-	if n == 0 {
-		return nil
+	return cr.KeyName, nil
+}
+
+// returns the security groups of the region profile in r with the given id.
+// see func (c *C) Ec2Region(aws.Region, string)
+func (c *C) Ec2SecurityGroups(r aws.Region, id string) ([]awsec2.SecurityGroup, error) {
+	cr, err := c.Ec2Region(r, id)
+	if cr == nil {
+		return nil, err
 	}
 
-	sgs := make([]awsec2.SecurityGroup, n)
-	for i, sg := range cr.SecurityGroups {
+	var sgs []awsec2.SecurityGroup
+	for _, sg := range cr.SecurityGroups {
 		if sg == (Ec2SecurityGroup{}) {
 			continue
 		}
-		sgs[i].Id = sg.Id
-		sgs[i].Name = sg.Name
+		sgs = append(sgs, awsec2.SecurityGroup{Id: sg.Id, Name: sg.Name})
 	}
 
-	return sgs
+	return sgs, nil
 }
 
-// like c.AwsKey() but returns an aws.Auth type
+// returns the account ids named by accounts, each an account id or the name of
+// a list in c.Images.AccountLists.  c.Images.ShareAccounts is used if accounts
+// is empty.  ids are returned in order without duplicates.
+func (c *C) ShareAccounts(accounts []string) ([]string, error) {
+	if len(accounts) == 0 {
+		accounts = c.Images.ShareAccounts
+	}
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("no accounts given or configured (Images.ShareAccounts)")
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	add := func(id string) error {
+		if !IsAccountId(id) {
+			return fmt.Errorf("invalid account id %q", id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+		return nil
+	}
+	for _, a := range accounts {
+		a = strings.TrimSpace(a)
+		list, ok := c.Images.AccountLists[a]
+		if !ok {
+			if err := add(a); err != nil {
+				return nil, fmt.Errorf("%v (not an account list)", err)
+			}
+			continue
+		}
+		for _, id := range list {
+			if err := add(id); err != nil {
+				return nil, fmt.Errorf("account list %q: %v", a, err)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// true if id is an aws account id, 12 digits.
+func IsAccountId(id string) bool {
+	if len(id) != 12 {
+		return false
+	}
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// like c.AwsCredentials() but returns an aws.Auth type
 func (c *C) AwsAuth() (aws.Auth, error) {
-	key, err := c.AwsKey()
+	creds, err := c.AwsCredentials()
 	if err != nil {
 		return aws.Auth{}, err
 	}
-	auth := aws.Auth{
-		AccessKey: key.AccessKey,
-		SecretKey: key.SecretKey,
+	return CredentialsAuth(creds), nil
+}
+
+// converts creds to an aws.Auth
+func CredentialsAuth(creds *oticreds.Credentials) aws.Auth {
+	return *aws.NewAuth(creds.AccessKey, creds.SecretKey, creds.SessionToken, creds.Expiration)
+}
+
+// locate aws credentials using the sources in c.Credentials. the Source field
+// of the result describes where they were found.
+func (c *C) AwsCredentials() (*oticreds.Credentials, error) {
+	chain, err := c.CredentialsChain()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := chain.Retrieve()
+	if err == oticreds.ErrNoCredentials {
+		return nil, fmt.Errorf("no aws credentials found (sources: %s)",
+			strings.Join(c.credentialSources(), ", "))
 	}
-	return auth, nil
+	return creds, err
+}
+
+// returns a provider of credentials for use with the region profile in r
+// with the given id.  if a role is configured for the region profile, or for
+// c, the provider assumes it.  when id is empty and r has several profiles
+// the role of c is used.
+func (c *C) RegionCredentials(r aws.Region, id string) (oticreds.Provider, error) {
+	chain, err := c.CredentialsChain()
+	if err != nil {
+		return nil, err
+	}
+	cr, err := c.Ec2Region(r, id)
+	if err != nil && id != "" {
+		return nil, err
+	}
+	role := c.AssumeRole
+	if cr != nil && cr.AssumeRole != nil {
+		role = cr.AssumeRole
+	}
+	if role == nil {
+		return chain, nil
+	}
+	if role.RoleArn == "" {
+		return nil, fmt.Errorf("AssumeRole missing RoleArn")
+	}
+	p := oticreds.AssumeRole{
+		Base:        chain,
+		RoleArn:     role.RoleArn,
+		ExternalId:  role.ExternalId,
+		SessionName: role.SessionName,
+		Duration:    time.Duration(role.DurationSeconds) * time.Second,
+		Endpoint:    role.Endpoint,
+		Region:      role.Region,
+	}
+	if cr := c.Ec2CustomRegion(r); cr != nil && cr.STSEndpoint != "" && role.Endpoint == "" {
+		p.Endpoint = cr.STSEndpoint
+		if p.Region == "" {
+			p.Region = cr.Name
+		}
+	}
+	return p, nil
+}
+
+// the credential providers for c.Credentials.Sources
+func (c *C) CredentialsChain() (oticreds.Chain, error) {
+	var chain oticreds.Chain
+	for _, src := range c.credentialSources() {
+		switch src {
+		case "env":
+			chain = append(chain, oticreds.Env{})
+		case "file":
+			chain = append(chain, oticreds.File{Path: c.AwsKeyPath})
+		case "shared":
+			chain = append(chain, oticreds.Shared{
+				CredentialsPath: c.Credentials.SharedCredentialsPath,
+				ConfigPath:      c.Credentials.SharedConfigPath,
+				Profile:         c.Credentials.SharedProfile,
+			})
+		case "metadata":
+			chain = append(chain, oticreds.Metadata{Endpoint: c.Credentials.MetadataEndpoint})
+		default:
+			return nil, fmt.Errorf("unknown credential source %q", src)
+		}
+	}
+	return chain, nil
+}
+
+func (c *C) credentialSources() []string {
+	if len(c.Credentials.Sources) > 0 {
+		return c.Credentials.Sources
+	}
+	return CredentialSources
 }
 
 // unmarshal the json data stored in c.AwsKeyPath into a new AwsKey. return
-// any error encountered.
+// any error encountered. the file must not be world-readable.
 func (c *C) AwsKey() (*AwsKey, error) {
-	// TODO stat and warn if permissions are not strict
-
-	keyp, err := ioutil.ReadFile(c.AwsKeyPath)
+	keyp, err := oticreds.ReadPrivateFile(c.AwsKeyPath)
 	if err != nil {
 		return nil, err
 	}
@@ -206,11 +722,25 @@ func (c *C) AwsKey() (*AwsKey, error) {
 	return &k, nil
 }
 
+// returns c.JournalDir, or ~/.oti/sessions if c.JournalDir is empty. oti
+// journals launch and terminate requests there so interrupted commands can be
+// recovered with `oti recover`.
+func (c *C) SessionJournalDir() (string, error) {
+	if c.JournalDir != "" {
+		return c.JournalDir, nil
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		return "", fmt.Errorf("HOME is not set")
+	}
+	return filepath.Join(home, ".oti", "sessions"), nil
+}
+
 // unmarshal a packer file by name. see c.Packers() for details about
 // names.
 func (c *C) PackerManifest(name string) (*PackerManifest, error) {
 	var p PackerManifest
-	ppath := filepath.Join(c.Packer.ManifestDir, name+".json")
+	ppath := c.PackerManifestPath(name)
 	pp, err := ioutil.ReadFile(ppath)
 	if err != nil {
 		return nil, err
@@ -224,6 +754,11 @@ func (c *C) PackerManifest(name string) (*PackerManifest, error) {
 	return &p, nil
 }
 
+// returns the path of the packer manifest with the given name.
+func (c *C) PackerManifestPath(name string) string {
+	return filepath.Join(c.Packer.ManifestDir, name+".json")
+}
+
 // return the name of packer manifests in c.PackerDir. the name of the
 // manifest is the file basename (without the ".json" extension).
 func (c *C) PackerManifestNames() ([]string, error) {
@@ -238,8 +773,9 @@ func (c *C) PackerManifestNames() ([]string, error) {
 }
 
 type AwsKey struct {
-	AccessKey string
-	SecretKey string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string `json:",omitempty"` // for temporary credentials
 }
 
 type PackerManifest struct {
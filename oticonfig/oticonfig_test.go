@@ -0,0 +1,46 @@
+package oticonfig
+
+import (
+	"github.com/bmatsuo/oti/oticreds"
+
+	"fmt"
+	"testing"
+)
+
+func TestCredentialsChain(t *testing.T) {
+	for _, test := range []struct {
+		sources []string
+		chain   string
+	}{
+		{nil, "[oticreds.Env oticreds.File oticreds.Shared oticreds.Metadata]"},
+		{[]string{"metadata", "env"}, "[oticreds.Metadata oticreds.Env]"},
+		{[]string{"file"}, "[oticreds.File]"},
+	} {
+		c := &C{AwsKeyPath: "aws_credentials.json"}
+		c.Credentials.Sources = test.sources
+		chain, err := c.CredentialsChain()
+		if err != nil {
+			t.Errorf("%q: %v", test.sources, err)
+			continue
+		}
+		var types []string
+		for _, p := range chain {
+			types = append(types, fmt.Sprintf("%T", p))
+		}
+		if s := fmt.Sprint(types); s != test.chain {
+			t.Errorf("%q: chain %s (expected %s)", test.sources, s, test.chain)
+		}
+		if len(chain) > 0 {
+			if f, ok := chain[len(chain)-1].(oticreds.File); ok && f.Path != c.AwsKeyPath {
+				t.Errorf("%q: file path %q", test.sources, f.Path)
+			}
+		}
+	}
+
+	c := &C{}
+	c.Credentials.Sources = []string{"env", "keychain"}
+	_, err := c.CredentialsChain()
+	if err == nil {
+		t.Errorf("unknown source accepted")
+	}
+}
@@ -0,0 +1,116 @@
+package oticreds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// the default address of the ec2 instance metadata service
+const MetadataEndpoint = "http://169.254.169.254"
+
+// reads the credentials of an instance's iam role from the ec2 instance
+// metadata service.  if the service cannot be reached there are no
+// credentials.  Endpoint defaults to MetadataEndpoint; setting it allows
+// testing against a local http server.
+type Metadata struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+func (p Metadata) Retrieve() (*Credentials, error) {
+	endpoint := strings.TrimSuffix(p.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = MetadataEndpoint
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 2 * time.Second}
+	}
+
+	// IMDSv2 requires a session token.  older services don't support it.
+	token := ""
+	req, err := http.NewRequest("PUT", endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, ErrNoCredentials
+	}
+	if resp.StatusCode == http.StatusOK {
+		b, err := ioutil.ReadAll(resp.Body)
+		if err == nil {
+			token = string(b)
+		}
+	}
+	resp.Body.Close()
+
+	get := func(path string) ([]byte, error) {
+		req, err := http.NewRequest("GET", endpoint+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			req.Header.Set("X-aws-ec2-metadata-token", token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNoCredentials
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("instance metadata %s: %s", path, resp.Status)
+		}
+		return ioutil.ReadAll(resp.Body)
+	}
+
+	const credpath = "/latest/meta-data/iam/security-credentials/"
+	roles, err := get(credpath)
+	if err != nil {
+		return nil, err
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return nil, ErrNoCredentials
+	}
+	rolep, err := get(credpath + role)
+	if err != nil {
+		return nil, err
+	}
+
+	var rolecreds struct {
+		Code            string
+		AccessKeyId     string
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	err = json.Unmarshal(rolep, &rolecreds)
+	if err != nil {
+		return nil, fmt.Errorf("instance metadata: %v", err)
+	}
+	if rolecreds.Code != "" && rolecreds.Code != "Success" {
+		return nil, fmt.Errorf("instance metadata: role %s: %s", role, rolecreds.Code)
+	}
+
+	creds := &Credentials{
+		AccessKey:    rolecreds.AccessKeyId,
+		SecretKey:    rolecreds.SecretAccessKey,
+		SessionToken: rolecreds.Token,
+		Expiration:   rolecreds.Expiration,
+		Source:       fmt.Sprintf("instance metadata %s (role %s)", endpoint, role),
+	}
+	err = creds.validate()
+	if err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
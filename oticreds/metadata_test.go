@@ -0,0 +1,101 @@
+package oticreds
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// a stand-in for the instance metadata service.  with imdsv2 requests
+// without the session token are refused.
+type metadataStub struct {
+	imdsv2 bool
+	role   string
+	creds  string
+}
+
+func (s *metadataStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const token = "stub-token"
+	if r.URL.Path == "/latest/api/token" {
+		if !s.imdsv2 || r.Method != "PUT" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, token)
+		return
+	}
+	if s.imdsv2 && r.Header.Get("X-aws-ec2-metadata-token") != token {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/latest/meta-data/iam/security-credentials/":
+		if s.role == "" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, s.role)
+	case "/latest/meta-data/iam/security-credentials/" + s.role:
+		fmt.Fprint(w, s.creds)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+const metadataCreds = `{
+	"Code": "Success",
+	"Type": "AWS-HMAC",
+	"AccessKeyId": "AKIDMETADATA",
+	"SecretAccessKey": "metadata-secret",
+	"Token": "metadata-token",
+	"Expiration": "2014-03-20T15:04:05Z"
+}`
+
+func TestMetadata(t *testing.T) {
+	for _, imdsv2 := range []bool{false, true} {
+		srv := httptest.NewServer(&metadataStub{imdsv2: imdsv2, role: "oti", creds: metadataCreds})
+		creds, err := Metadata{Endpoint: srv.URL + "/"}.Retrieve()
+		srv.Close()
+		if err != nil {
+			t.Errorf("imdsv2=%v: %v", imdsv2, err)
+			continue
+		}
+		if creds.AccessKey != "AKIDMETADATA" || creds.SecretKey != "metadata-secret" || creds.SessionToken != "metadata-token" {
+			t.Errorf("imdsv2=%v: unexpected credentials %+v", imdsv2, creds)
+		}
+		expires := time.Date(2014, 3, 20, 15, 4, 5, 0, time.UTC)
+		if !creds.Expiration.Equal(expires) {
+			t.Errorf("imdsv2=%v: expiration %v (expected %v)", imdsv2, creds.Expiration, expires)
+		}
+	}
+}
+
+func TestMetadataNoRole(t *testing.T) {
+	srv := httptest.NewServer(&metadataStub{imdsv2: true})
+	defer srv.Close()
+	_, err := Metadata{Endpoint: srv.URL}.Retrieve()
+	if err != ErrNoCredentials {
+		t.Errorf("expected ErrNoCredentials: %v", err)
+	}
+}
+
+func TestMetadataUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	endpoint := srv.URL
+	srv.Close()
+	_, err := Metadata{Endpoint: endpoint}.Retrieve()
+	if err != ErrNoCredentials {
+		t.Errorf("expected ErrNoCredentials: %v", err)
+	}
+}
+
+func TestMetadataFailure(t *testing.T) {
+	srv := httptest.NewServer(&metadataStub{role: "oti", creds: `{"Code": "AssumeRoleUnauthorizedAccess"}`})
+	defer srv.Close()
+	_, err := Metadata{Endpoint: srv.URL}.Retrieve()
+	if err == nil || err == ErrNoCredentials {
+		t.Errorf("expected an error: %v", err)
+	}
+}
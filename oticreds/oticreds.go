@@ -0,0 +1,180 @@
+/*
+locate aws credentials.
+
+credentials are located by a chain of providers, each of which looks in one
+place.  the first provider that finds credentials is used.
+
+	env       AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+	          (or AWS_ACCESS_KEY, AWS_SECRET_KEY and AWS_SECURITY_TOKEN)
+	file      a json file, {"AccessKey": "...", "SecretKey": "..."}, with an
+	          optional "SessionToken"
+	shared    the aws cli shared credentials and config files
+	          (~/.aws/credentials and ~/.aws/config) for a named profile
+	metadata  the ec2 instance metadata service, for instances with an iam
+	          role
+
+the credentials found can be used to assume a role through sts (see
+AssumeRole) and cached until they expire (see Cache).
+
+credentials files that are readable by all users are refused.  credentials
+in an aws cli config file readable by all users are skipped with a warning
+(see Warn) because the file is otherwise not secret.
+*/
+package oticreds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// returned by a provider that does not have credentials.  other errors stop
+// the search.
+var ErrNoCredentials = errors.New("no credentials")
+
+// called with warnings about credentials that were skipped.  warnings are
+// discarded by default.
+var Warn = func(msg string) {}
+
+type Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string    // empty for long term credentials
+	Expiration   time.Time // zero for long term credentials
+	AssumedRole  string    // the arn of the assumed role user, if any
+	Source       string    // describes where the credentials were found
+}
+
+// true if the credentials expire within d.
+func (c *Credentials) ExpiresWithin(d time.Duration) bool {
+	if c.Expiration.IsZero() {
+		return false
+	}
+	return time.Now().Add(d).After(c.Expiration)
+}
+
+func (c *Credentials) validate() error {
+	if c.AccessKey == "" {
+		return fmt.Errorf("%s: missing access key", c.Source)
+	}
+	if c.SecretKey == "" {
+		return fmt.Errorf("%s: missing secret key", c.Source)
+	}
+	return nil
+}
+
+type Provider interface {
+	Retrieve() (*Credentials, error)
+}
+
+// a provider that tries each of its providers in order.
+type Chain []Provider
+
+func (c Chain) Retrieve() (*Credentials, error) {
+	for _, p := range c {
+		creds, err := p.Retrieve()
+		if err == ErrNoCredentials {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return creds, nil
+	}
+	return nil, ErrNoCredentials
+}
+
+// reads credentials from environment variables.
+type Env struct{}
+
+func (Env) Retrieve() (*Credentials, error) {
+	creds := &Credentials{
+		AccessKey:    getenv("AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY"),
+		SecretKey:    getenv("AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY"),
+		SessionToken: getenv("AWS_SESSION_TOKEN", "AWS_SECURITY_TOKEN"),
+		Source:       "environment",
+	}
+	if creds.AccessKey == "" && creds.SecretKey == "" {
+		return nil, ErrNoCredentials
+	}
+	err := creds.validate()
+	if err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+func getenv(keys ...string) string {
+	for _, k := range keys {
+		v := os.Getenv(k)
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// reads credentials from a json file.  a missing file has no credentials.
+type File struct {
+	Path string
+}
+
+func (p File) Retrieve() (*Credentials, error) {
+	if p.Path == "" {
+		return nil, ErrNoCredentials
+	}
+	keyp, err := ReadPrivateFile(p.Path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var key struct {
+		AccessKey    string
+		SecretKey    string
+		SessionToken string
+	}
+	err = json.Unmarshal(keyp, &key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", p.Path, err)
+	}
+
+	creds := &Credentials{
+		AccessKey:    key.AccessKey,
+		SecretKey:    key.SecretKey,
+		SessionToken: key.SessionToken,
+		Source:       "file " + p.Path,
+	}
+	err = creds.validate()
+	if err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// reads a file containing secrets.  an error is returned if the file is
+// readable by all users.
+func ReadPrivateFile(path string) ([]byte, error) {
+	err := CheckPermissions(path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
+
+// returns an error if the file at path is readable by all users.
+func CheckPermissions(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0004 != 0 {
+		return fmt.Errorf("refusing to read %s: file is world-readable (chmod 0400 %s)", path, path)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package oticreds
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type staticProvider struct {
+	creds *Credentials
+	err   error
+}
+
+func (p staticProvider) Retrieve() (*Credentials, error) {
+	return p.creds, p.err
+}
+
+func TestChain(t *testing.T) {
+	a := &Credentials{AccessKey: "a", SecretKey: "a", Source: "a"}
+	b := &Credentials{AccessKey: "b", SecretKey: "b", Source: "b"}
+	none := staticProvider{err: ErrNoCredentials}
+	broken := staticProvider{err: errors.New("broken")}
+
+	for i, test := range []struct {
+		chain  Chain
+		source string
+		err    error
+	}{
+		{Chain{staticProvider{creds: a}, staticProvider{creds: b}}, "a", nil},
+		{Chain{none, staticProvider{creds: b}, staticProvider{creds: a}}, "b", nil},
+		{Chain{none, broken, staticProvider{creds: a}}, "", broken.err},
+		{Chain{none, none}, "", ErrNoCredentials},
+		{Chain{}, "", ErrNoCredentials},
+	} {
+		creds, err := test.chain.Retrieve()
+		if err != test.err {
+			t.Errorf("%d: error %v (expected %v)", i, err, test.err)
+			continue
+		}
+		if err == nil && creds.Source != test.source {
+			t.Errorf("%d: credentials from %q (expected %q)", i, creds.Source, test.source)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string, perm os.FileMode) {
+	os.Remove(path)
+	err := ioutil.WriteFile(path, []byte(content), perm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// WriteFile permissions are subject to the umask.
+	err = os.Chmod(path, perm)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// each source in the default order is used only when the sources before it
+// have no credentials.
+func TestChainOrder(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	for _, k := range []string{
+		"AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_SHARED_CREDENTIALS_FILE", "AWS_CONFIG_FILE",
+		"AWS_ACCESS_KEY", "AWS_SECRET_KEY", "AWS_SESSION_TOKEN", "AWS_SECURITY_TOKEN",
+	} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+
+	keypath := filepath.Join(dir, "aws_credentials.json")
+	writeFile(t, keypath, `{"AccessKey": "AKIDFILE", "SecretKey": "file-secret"}`, 0400)
+	sharedpath := filepath.Join(dir, "credentials")
+	writeFile(t, sharedpath, "[default]\naws_access_key_id = AKIDSHARED\naws_secret_access_key = shared-secret\n", 0600)
+	srv := httptest.NewServer(&metadataStub{role: "oti", creds: metadataCreds})
+	defer srv.Close()
+
+	chain := Chain{
+		Env{},
+		File{Path: keypath},
+		Shared{CredentialsPath: sharedpath, ConfigPath: filepath.Join(dir, "config")},
+		Metadata{Endpoint: srv.URL},
+	}
+	for _, test := range []struct {
+		access string
+		remove func()
+	}{
+		{"AKIDENV", func() {
+			t.Setenv("AWS_ACCESS_KEY_ID", "")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+		}},
+		{"AKIDFILE", func() { os.Remove(keypath) }},
+		{"AKIDSHARED", func() { os.Remove(sharedpath) }},
+		{"AKIDMETADATA", func() {}},
+	} {
+		creds, err := chain.Retrieve()
+		if err != nil {
+			t.Fatalf("expected %s: %v", test.access, err)
+		}
+		if creds.AccessKey != test.access {
+			t.Fatalf("credentials %s from %s (expected %s)", creds.AccessKey, creds.Source, test.access)
+		}
+		test.remove()
+	}
+}
+
+func TestWorldReadable(t *testing.T) {
+	dir := t.TempDir()
+	keypath := filepath.Join(dir, "aws_credentials.json")
+	sharedpath := filepath.Join(dir, "credentials")
+	for _, perm := range []os.FileMode{0644, 0604} {
+		writeFile(t, keypath, `{"AccessKey": "AKID", "SecretKey": "secret"}`, perm)
+		writeFile(t, sharedpath, "[default]\naws_access_key_id = AKID\naws_secret_access_key = secret\n", perm)
+		for _, p := range []Provider{
+			File{Path: keypath},
+			Shared{CredentialsPath: sharedpath, ConfigPath: filepath.Join(dir, "config"), Profile: "default"},
+		} {
+			_, err := p.Retrieve()
+			if err == nil || !strings.Contains(err.Error(), "world-readable") {
+				t.Errorf("%T %o: expected a world-readable error: %v", p, perm, err)
+			}
+		}
+	}
+
+	for _, perm := range []os.FileMode{0400, 0640} {
+		writeFile(t, keypath, `{"AccessKey": "AKID", "SecretKey": "secret"}`, perm)
+		creds, err := File{Path: keypath}.Retrieve()
+		if err != nil {
+			t.Errorf("%o: %v", perm, err)
+		} else if creds.AccessKey != "AKID" {
+			t.Errorf("%o: access key %q", perm, creds.AccessKey)
+		}
+	}
+}
+
+// the aws cli config file is commonly readable by all users.  it does not stop
+// the chain.
+func TestSharedConfigWorldReadable(t *testing.T) {
+	dir := t.TempDir()
+	configpath := filepath.Join(dir, "config")
+	shared := Shared{CredentialsPath: filepath.Join(dir, "credentials"), ConfigPath: configpath, Profile: "ci"}
+	next := staticProvider{creds: &Credentials{AccessKey: "AKIDMETA", SecretKey: "secret", Source: "metadata"}}
+
+	var warnings []string
+	defer func(warn func(string)) { Warn = warn }(Warn)
+	Warn = func(msg string) { warnings = append(warnings, msg) }
+
+	writeFile(t, configpath, "[default]\nregion = us-east-1\n[profile ci]\nregion = us-west-2\n", 0644)
+	creds, err := Chain{shared, next}.Retrieve()
+	if err != nil || creds.Source != "metadata" {
+		t.Errorf("config without credentials: %v %v", creds, err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings %q", warnings)
+	}
+
+	writeFile(t, configpath, "[profile ci]\naws_access_key_id = AKIDCONFIG\naws_secret_access_key = secret\n", 0644)
+	creds, err = Chain{shared, next}.Retrieve()
+	if err != nil || creds.Source != "metadata" {
+		t.Errorf("world-readable config: %v %v", creds, err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "world-readable") {
+		t.Errorf("warnings %q", warnings)
+	}
+
+	writeFile(t, configpath, "[profile ci]\naws_access_key_id = AKIDCONFIG\naws_secret_access_key = secret\n", 0600)
+	creds, err = Chain{shared, next}.Retrieve()
+	if err != nil || creds.AccessKey != "AKIDCONFIG" {
+		t.Errorf("private config: %v %v", creds, err)
+	}
+}
+
+func TestFileMissing(t *testing.T) {
+	_, err := File{Path: filepath.Join(t.TempDir(), "missing.json")}.Retrieve()
+	if err != ErrNoCredentials {
+		t.Errorf("expected ErrNoCredentials: %v", err)
+	}
+}
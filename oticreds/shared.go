@@ -0,0 +1,153 @@
+package oticreds
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// reads credentials for a profile from the aws cli shared credentials file
+// and, failing that, the shared config file.  empty fields use the aws cli
+// defaults: ~/.aws/credentials, ~/.aws/config, and the profile named by
+// AWS_PROFILE or "default".
+type Shared struct {
+	CredentialsPath string
+	ConfigPath      string
+	Profile         string
+}
+
+func (p Shared) Retrieve() (*Credentials, error) {
+	profile := p.Profile
+	if profile == "" {
+		profile = getenv("AWS_PROFILE", "AWS_DEFAULT_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	credspath := p.CredentialsPath
+	if credspath == "" {
+		credspath = getenv("AWS_SHARED_CREDENTIALS_FILE")
+	}
+	if credspath == "" {
+		credspath = awsdir("credentials")
+	}
+	// in the credentials file sections are named after profiles.
+	creds, err := p.retrieve(credspath, profile, true)
+	if err != ErrNoCredentials {
+		return creds, err
+	}
+
+	configpath := p.ConfigPath
+	if configpath == "" {
+		configpath = getenv("AWS_CONFIG_FILE")
+	}
+	if configpath == "" {
+		configpath = awsdir("config")
+	}
+	// in the config file sections other than the default are "profile name".
+	section := profile
+	if profile != "default" {
+		section = "profile " + profile
+	}
+	return p.retrieve(configpath, section, false)
+}
+
+// read credentials from the section of the ini file at path.  a secret file
+// that is readable by all users is refused.  the config file is commonly
+// readable by all users so credentials found in it are skipped with a warning
+// instead.
+func (p Shared) retrieve(path, section string, secret bool) (*Credentials, error) {
+	if path == "" {
+		return nil, ErrNoCredentials
+	}
+	var content []byte
+	var err error
+	if secret {
+		content, err = ReadPrivateFile(path)
+	} else {
+		content, err = ioutil.ReadFile(path)
+	}
+	if os.IsNotExist(err) {
+		return nil, ErrNoCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	ini, err := parseINI(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	kv, ok := ini[section]
+	if !ok || kv["aws_access_key_id"] == "" {
+		return nil, ErrNoCredentials
+	}
+	creds := &Credentials{
+		AccessKey:    kv["aws_access_key_id"],
+		SecretKey:    kv["aws_secret_access_key"],
+		SessionToken: kv["aws_session_token"],
+		Source:       fmt.Sprintf("shared file %s [%s]", path, section),
+	}
+	if creds.SessionToken == "" {
+		creds.SessionToken = kv["aws_security_token"]
+	}
+	if !secret {
+		err := CheckPermissions(path)
+		if err != nil {
+			Warn(fmt.Sprintf("skipping credentials in %s [%s]: %v", path, section, err))
+			return nil, ErrNoCredentials
+		}
+	}
+	err = creds.validate()
+	if err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+func awsdir(name string) string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, ".aws", name)
+}
+
+// parses the ini format used by the aws cli.  keys outside of a section are
+// an error.
+func parseINI(content []byte) (map[string]map[string]string, error) {
+	ini := make(map[string]map[string]string)
+	var section map[string]string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("line %d: invalid section", lineno)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			section = ini[name]
+			if section == nil {
+				section = make(map[string]string)
+				ini[name] = section
+			}
+			continue
+		}
+		pair := strings.SplitN(line, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineno)
+		}
+		if section == nil {
+			return nil, fmt.Errorf("line %d: key outside of a section", lineno)
+		}
+		section[strings.TrimSpace(pair[0])] = strings.TrimSpace(pair[1])
+	}
+	return ini, scanner.Err()
+}
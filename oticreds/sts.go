@@ -0,0 +1,223 @@
+package oticreds
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the default sts endpoint
+const STSEndpoint = "https://sts.amazonaws.com"
+
+// obtains temporary credentials for a role using the credentials from Base.
+// Endpoint defaults to STSEndpoint and Region, the region used to sign
+// requests, to "us-east-1".  setting Endpoint allows testing against a local
+// http server.
+type AssumeRole struct {
+	Base        Provider
+	RoleArn     string
+	ExternalId  string        // optional
+	SessionName string        // defaults to "oti"
+	Duration    time.Duration // defaults to one hour
+	Endpoint    string
+	Region      string
+	Client      *http.Client
+}
+
+func (p AssumeRole) Retrieve() (*Credentials, error) {
+	if p.RoleArn == "" {
+		return nil, fmt.Errorf("no role arn to assume")
+	}
+	base, err := p.Base.Retrieve()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = STSEndpoint
+	}
+	region := p.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	sessionName := p.SessionName
+	if sessionName == "" {
+		sessionName = "oti"
+	}
+	duration := p.Duration
+	if duration == 0 {
+		duration = time.Hour
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	form := url.Values{}
+	form.Set("Action", "AssumeRole")
+	form.Set("Version", "2011-06-15")
+	form.Set("RoleArn", p.RoleArn)
+	form.Set("RoleSessionName", sessionName)
+	form.Set("DurationSeconds", strconv.Itoa(int(duration/time.Second)))
+	if p.ExternalId != "" {
+		form.Set("ExternalId", p.ExternalId)
+	}
+	body := form.Encode()
+
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	SignV4(req, []byte(body), base, region, "sts", time.Now())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("assume role %s: %v", p.RoleArn, err)
+	}
+	defer resp.Body.Close()
+	respbody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("assume role %s: %v", p.RoleArn, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var stserr struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		xml.Unmarshal(respbody, &stserr)
+		if stserr.Code != "" {
+			return nil, fmt.Errorf("assume role %s: %s: %s", p.RoleArn, stserr.Code, stserr.Message)
+		}
+		return nil, fmt.Errorf("assume role %s: %s", p.RoleArn, resp.Status)
+	}
+
+	var result struct {
+		AccessKeyId     string    `xml:"AssumeRoleResult>Credentials>AccessKeyId"`
+		SecretAccessKey string    `xml:"AssumeRoleResult>Credentials>SecretAccessKey"`
+		SessionToken    string    `xml:"AssumeRoleResult>Credentials>SessionToken"`
+		Expiration      time.Time `xml:"AssumeRoleResult>Credentials>Expiration"`
+		Arn             string    `xml:"AssumeRoleResult>AssumedRoleUser>Arn"`
+	}
+	err = xml.Unmarshal(respbody, &result)
+	if err != nil {
+		return nil, fmt.Errorf("assume role %s: %v", p.RoleArn, err)
+	}
+
+	creds := &Credentials{
+		AccessKey:    result.AccessKeyId,
+		SecretKey:    result.SecretAccessKey,
+		SessionToken: result.SessionToken,
+		Expiration:   result.Expiration,
+		AssumedRole:  result.Arn,
+		Source:       fmt.Sprintf("role %s assumed with %s", p.RoleArn, base.Source),
+	}
+	err = creds.validate()
+	if err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// sign req using aws signature version 4.  body must be the request body.
+func SignV4(req *http.Request, body []byte, creds *Credentials, region, service string, t time.Time) {
+	t = t.UTC()
+	amzdate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzdate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	var names []string
+	headers := make(map[string]string)
+	for k, vs := range req.Header {
+		name := strings.ToLower(k)
+		names = append(names, name)
+		headers[name] = strings.TrimSpace(strings.Join(vs, ","))
+	}
+	sort.Strings(names)
+	var canonheaders string
+	for _, name := range names {
+		canonheaders += name + ":" + headers[name] + "\n"
+	}
+	signedheaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonreq := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonheaders,
+		signedheaders,
+		hexsha256(body),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	tosign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzdate,
+		scope,
+		hexsha256([]byte(canonreq)),
+	}, "\n")
+
+	key := hmacsha256([]byte("AWS4"+creds.SecretKey), date)
+	key = hmacsha256(key, region)
+	key = hmacsha256(key, service)
+	key = hmacsha256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacsha256(key, tosign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKey, scope, signedheaders, sig))
+}
+
+func hexsha256(p []byte) string {
+	h := sha256.Sum256(p)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacsha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// caches the credentials of Provider until they are about to expire.
+type Cache struct {
+	Provider Provider
+	Window   time.Duration // refresh credentials expiring within Window
+
+	mut   sync.Mutex
+	creds *Credentials
+}
+
+func (c *Cache) Retrieve() (*Credentials, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if c.creds != nil && !c.creds.ExpiresWithin(c.Window) {
+		return c.creds, nil
+	}
+	creds, err := c.Provider.Retrieve()
+	if err != nil {
+		return nil, err
+	}
+	c.creds = creds
+	return creds, nil
+}
@@ -0,0 +1,256 @@
+package oticreds
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// known answers from the aws signature version 4 test suite.
+var sigv4Tests = []struct {
+	name   string
+	method string
+	url    string
+	header map[string]string
+	body   string
+	auth   string
+}{
+	{
+		name:   "get-vanilla",
+		method: "GET",
+		url:    "https://example.amazonaws.com/",
+		auth:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+	},
+	{
+		name:   "get-vanilla-query-order-key-case",
+		method: "GET",
+		url:    "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+		auth:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+	},
+	{
+		name:   "post-x-www-form-urlencoded",
+		method: "POST",
+		url:    "https://example.amazonaws.com/",
+		header: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+		body:   "Param1=value1",
+		auth:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+	},
+}
+
+func TestSignV4(t *testing.T) {
+	creds := &Credentials{AccessKey: "AKIDEXAMPLE", SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	date := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	for _, test := range sigv4Tests {
+		req, err := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range test.header {
+			req.Header.Set(k, v)
+		}
+		SignV4(req, []byte(test.body), creds, "us-east-1", "service", date)
+		if auth := req.Header.Get("Authorization"); auth != test.auth {
+			t.Errorf("%s: authorization\n\t%s\nexpected\n\t%s", test.name, auth, test.auth)
+		}
+		if d := req.Header.Get("X-Amz-Date"); d != "20150830T123600Z" {
+			t.Errorf("%s: date %q", test.name, d)
+		}
+	}
+}
+
+func TestSignV4SessionToken(t *testing.T) {
+	creds := &Credentials{AccessKey: "AKIDEXAMPLE", SecretKey: "secret", SessionToken: "token"}
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	SignV4(req, nil, creds, "us-east-1", "service", time.Now())
+	if req.Header.Get("X-Amz-Security-Token") != "token" {
+		t.Errorf("no security token header")
+	}
+	if !strings.Contains(req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token,") {
+		t.Errorf("security token not signed: %s", req.Header.Get("Authorization"))
+	}
+}
+
+// a stand-in for sts.  each AssumeRole request is checked and answered with
+// new credentials that expire after ttl.
+type stsStub struct {
+	t   *testing.T
+	ttl time.Duration
+
+	mut      sync.Mutex
+	requests int
+	form     map[string]string
+}
+
+func (s *stsStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.requests++
+
+	body, _ := ioutil.ReadAll(r.Body)
+	auth := r.Header.Get("Authorization")
+	prefix := "AWS4-HMAC-SHA256 Credential=AKIDBASE/" + time.Now().UTC().Format("20060102") + "/us-east-1/sts/aws4_request, "
+	if !strings.HasPrefix(auth, prefix) {
+		s.t.Errorf("authorization %q", auth)
+	}
+	// sign the request again to check the signature.
+	resign, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.String(), nil)
+	resign.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		s.t.Errorf("date: %v", err)
+	}
+	SignV4(resign, body, &Credentials{AccessKey: "AKIDBASE", SecretKey: "base-secret"}, "us-east-1", "sts", date)
+	if resign.Header.Get("Authorization") != auth {
+		s.t.Errorf("signature mismatch\n\t%s\n\t%s", auth, resign.Header.Get("Authorization"))
+	}
+
+	form, err := parseForm(string(body))
+	if err != nil {
+		s.t.Error(err)
+	}
+	s.form = form
+	if form["RoleArn"] == "arn:aws:iam::123456789012:role/denied" {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>not authorized</Message></Error></ErrorResponse>`)
+		return
+	}
+	expires := time.Now().Add(s.ttl).UTC().Format(time.RFC3339)
+	fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <AssumedRoleUser>
+      <Arn>arn:aws:sts::123456789012:assumed-role/oti/%s</Arn>
+      <AssumedRoleId>AROA:%s</AssumedRoleId>
+    </AssumedRoleUser>
+    <Credentials>
+      <AccessKeyId>AKIDROLE%d</AccessKeyId>
+      <SecretAccessKey>role-secret</SecretAccessKey>
+      <SessionToken>role-token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`, form["RoleSessionName"], form["RoleSessionName"], s.requests, expires)
+}
+
+func parseForm(body string) (map[string]string, error) {
+	req, err := http.NewRequest("POST", "/", strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	err = req.ParseForm()
+	if err != nil {
+		return nil, err
+	}
+	form := make(map[string]string)
+	for k := range req.PostForm {
+		form[k] = req.PostForm.Get(k)
+	}
+	return form, nil
+}
+
+var baseCreds = staticProvider{creds: &Credentials{AccessKey: "AKIDBASE", SecretKey: "base-secret", Source: "base"}}
+
+func TestAssumeRole(t *testing.T) {
+	stub := &stsStub{t: t, ttl: time.Hour}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	p := AssumeRole{
+		Base:       baseCreds,
+		RoleArn:    "arn:aws:iam::123456789012:role/oti",
+		ExternalId: "external",
+		Duration:   15 * time.Minute,
+		Endpoint:   srv.URL,
+	}
+	creds, err := p.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKey != "AKIDROLE1" || creds.SecretKey != "role-secret" || creds.SessionToken != "role-token" {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+	if creds.AssumedRole != "arn:aws:sts::123456789012:assumed-role/oti/oti" {
+		t.Errorf("assumed role %q", creds.AssumedRole)
+	}
+	if !creds.ExpiresWithin(2*time.Hour) || creds.ExpiresWithin(30*time.Minute) {
+		t.Errorf("expiration %v", creds.Expiration)
+	}
+	for k, v := range map[string]string{
+		"Action":          "AssumeRole",
+		"Version":         "2011-06-15",
+		"RoleArn":         p.RoleArn,
+		"RoleSessionName": "oti",
+		"ExternalId":      "external",
+		"DurationSeconds": "900",
+	} {
+		if stub.form[k] != v {
+			t.Errorf("%s=%q (expected %q)", k, stub.form[k], v)
+		}
+	}
+}
+
+func TestAssumeRoleDenied(t *testing.T) {
+	srv := httptest.NewServer(&stsStub{t: t, ttl: time.Hour})
+	defer srv.Close()
+
+	p := AssumeRole{
+		Base:     baseCreds,
+		RoleArn:  "arn:aws:iam::123456789012:role/denied",
+		Endpoint: srv.URL,
+	}
+	_, err := p.Retrieve()
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied: not authorized") {
+		t.Errorf("expected AccessDenied: %v", err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	stub := &stsStub{t: t, ttl: time.Hour}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	c := &Cache{
+		Provider: AssumeRole{Base: baseCreds, RoleArn: "arn:aws:iam::123456789012:role/oti", Endpoint: srv.URL},
+		Window:   5 * time.Minute,
+	}
+	retrieve := func(access string) {
+		t.Helper()
+		creds, err := c.Retrieve()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.AccessKey != access {
+			t.Fatalf("access key %s (expected %s)", creds.AccessKey, access)
+		}
+	}
+
+	// unexpired credentials are reused.
+	retrieve("AKIDROLE1")
+	retrieve("AKIDROLE1")
+	if stub.requests != 1 {
+		t.Fatalf("%d requests", stub.requests)
+	}
+
+	// credentials expiring within the window are refreshed.
+	stub.ttl = time.Minute
+	c.creds.Expiration = time.Now().Add(time.Minute)
+	retrieve("AKIDROLE2")
+	retrieve("AKIDROLE3")
+	if stub.requests != 3 {
+		t.Fatalf("%d requests", stub.requests)
+	}
+
+	// long term credentials never expire.
+	long := &Cache{Provider: baseCreds, Window: time.Hour}
+	for i := 0; i < 2; i++ {
+		creds, err := long.Retrieve()
+		if err != nil || creds.AccessKey != "AKIDBASE" {
+			t.Fatalf("%v %v", creds, err)
+		}
+	}
+}
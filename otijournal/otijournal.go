@@ -0,0 +1,248 @@
+/*
+a local record of the EC2 requests made by oti.
+
+a journal is written before and after each request oti makes that allocates or
+destroys resources.  if oti dies part way through a command the journal left
+behind names the instances it created (or the client tokens that can be used
+to find them) so that they can be tagged or terminated later.  journals are
+removed when the command that created them finishes.
+*/
+package otijournal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Begin = "begin" // written before a request is sent
+	End   = "end"   // written after a response (or error) is received
+)
+
+// a single journal entry.
+type Entry struct {
+	Time        time.Time
+	Op          string // EC2 action (e.g. "RunInstances")
+	Phase       string // Begin or End
+	Manifest    string `json:",omitempty"` // launch manifest name
+	ClientToken string `json:",omitempty"` // RunInstances client token
+	IndexOffset int    `json:",omitempty"` // index of the manifest's first instance
+
+	// the RunInstances idempotency key and assumed role tagged on instances
+	IdempotencyKey string `json:",omitempty"`
+	AssumedRole    string `json:",omitempty"`
+
+	InstanceIds []string `json:",omitempty"`
+	Err         string   `json:",omitempty"`
+}
+
+// a journal for one invocation of an oti command.  the methods of a nil
+// *Journal do nothing, so callers need not check whether journaling is
+// enabled.
+type Journal struct {
+	Name      string // the file basename without the ".json" extension
+	Command   string // "launch" or "terminate"
+	SessionId string `json:",omitempty"`
+	Region    string
+	Started   time.Time
+	Entries   []Entry
+
+	path string
+	mut  sync.Mutex
+}
+
+// create a new journal in dir named name.  the journal is written to disk
+// before Create returns.
+func Create(dir, name, command, sessionId, region string) (*Journal, error) {
+	if name == "" {
+		return nil, fmt.Errorf("no journal name")
+	}
+	if strings.ContainsRune(name, filepath.Separator) {
+		return nil, fmt.Errorf("invalid journal name %q", name)
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{
+		Name:      name,
+		Command:   command,
+		SessionId: sessionId,
+		Region:    region,
+		Started:   time.Now().UTC(),
+		path:      filepath.Join(dir, name+".json"),
+	}
+	err = j.write()
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// read the journal stored at path.
+func Open(path string) (*Journal, error) {
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	j := new(Journal)
+	err = json.Unmarshal(p, j)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	j.path = path
+	return j, nil
+}
+
+// read all journals in dir, oldest first.  because journals are removed when
+// their command finishes every journal found belongs to an incomplete
+// command.  a missing dir is not an error.  files that cannot be read are
+// skipped and their errors returned in bad so the other journals can still be
+// recovered.
+func ReadDir(dir string) (journals []*Journal, bad []error, err error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, path := range paths {
+		j, err := Open(path)
+		if err != nil {
+			bad = append(bad, err)
+			continue
+		}
+		journals = append(journals, j)
+	}
+	sort.Sort(byStarted(journals))
+	return journals, bad, nil
+}
+
+type byStarted []*Journal
+
+func (js byStarted) Len() int           { return len(js) }
+func (js byStarted) Less(i, j int) bool { return js[i].Started.Before(js[j].Started) }
+func (js byStarted) Swap(i, j int)      { js[i], js[j] = js[j], js[i] }
+
+// the location of the journal on disk.
+func (j *Journal) Path() string {
+	if j == nil {
+		return ""
+	}
+	return j.path
+}
+
+// record that a request is about to be sent.
+func (j *Journal) Begin(e Entry) error {
+	e.Phase = Begin
+	return j.append(e)
+}
+
+// record the outcome of a request.  err is the error returned by the
+// request, if any.
+func (j *Journal) End(e Entry, err error) error {
+	e.Phase = End
+	if err != nil {
+		e.Err = err.Error()
+	}
+	return j.append(e)
+}
+
+func (j *Journal) append(e Entry) error {
+	if j == nil {
+		return nil
+	}
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	j.Entries = append(j.Entries, e)
+	return j.write()
+}
+
+// remove the journal from disk.  called when its command finishes.
+func (j *Journal) Remove() error {
+	if j == nil {
+		return nil
+	}
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	err := os.Remove(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// the instance ids recorded in entries for op.
+func (j *Journal) InstanceIds(op string) []string {
+	if j == nil {
+		return nil
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, e := range j.Entries {
+		if e.Op != op {
+			continue
+		}
+		for _, id := range e.InstanceIds {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// requests for op that were begun but never ended.  the Begin entries are
+// returned.
+func (j *Journal) Unfinished(op string) []Entry {
+	if j == nil {
+		return nil
+	}
+	var es []Entry
+	for i, e := range j.Entries {
+		if e.Op != op || e.Phase != Begin {
+			continue
+		}
+		ended := false
+		for _, _e := range j.Entries[i+1:] {
+			if _e.Op == op && _e.Phase == End && sameRequest(e, _e) {
+				ended = true
+				break
+			}
+		}
+		if !ended {
+			es = append(es, e)
+		}
+	}
+	return es
+}
+
+func sameRequest(begin, end Entry) bool {
+	if begin.ClientToken != "" || end.ClientToken != "" {
+		return begin.ClientToken == end.ClientToken
+	}
+	return begin.Manifest == end.Manifest
+}
+
+// write the journal atomically so a crash never leaves a partial file.
+func (j *Journal) write() error {
+	p, err := json.MarshalIndent(j, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	err = ioutil.WriteFile(tmp, p, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
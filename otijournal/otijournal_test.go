@@ -0,0 +1,170 @@
+package otijournal
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	j, err := Create(dir, "web-1234", "launch", "web:1234", "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := Entry{
+		Op:             "RunInstances",
+		Manifest:       "web",
+		ClientToken:    "token",
+		IdempotencyKey: "key",
+		AssumedRole:    "arn:aws:sts::123456789012:assumed-role/oti/oti",
+	}
+	err = j.Begin(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.InstanceIds = []string{"i-1", "i-2"}
+	err = j.End(e, errors.New("partial"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// writes are atomic and leave only the journal behind.
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != j.Path() {
+		t.Errorf("files %q", names)
+	}
+	info, err := os.Stat(j.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode %v", info.Mode())
+	}
+
+	_j, err := Open(j.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _j.Name != j.Name || _j.SessionId != j.SessionId || !reflect.DeepEqual(_j.Entries, j.Entries) {
+		t.Errorf("reopened %+v\nexpected %+v", _j, j)
+	}
+	if end := _j.Entries[1]; end.Phase != End || end.Err != "partial" || end.IdempotencyKey != "key" || end.AssumedRole == "" {
+		t.Errorf("end entry %+v", end)
+	}
+	if ids := _j.InstanceIds("RunInstances"); !reflect.DeepEqual(ids, []string{"i-1", "i-2"}) {
+		t.Errorf("instance ids %q", ids)
+	}
+
+	err = j.Remove()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = j.Remove()
+	if err != nil {
+		t.Errorf("second remove: %v", err)
+	}
+}
+
+func TestCreateInvalidName(t *testing.T) {
+	for _, name := range []string{"", "a/b"} {
+		_, err := Create(t.TempDir(), name, "launch", "", "us-east-1")
+		if err == nil {
+			t.Errorf("%q accepted", name)
+		}
+	}
+}
+
+func TestUnfinished(t *testing.T) {
+	j := &Journal{Entries: []Entry{
+		{Op: "RunInstances", Phase: Begin, Manifest: "web", ClientToken: "a"},
+		{Op: "RunInstances", Phase: Begin, Manifest: "web", ClientToken: "b"},
+		{Op: "RunInstances", Phase: Begin, Manifest: "db"},
+		{Op: "RunInstances", Phase: Begin, Manifest: "cache"},
+		{Op: "CreateTags", Phase: Begin, Manifest: "web"},
+		// ends are matched by client token, or by manifest without one.
+		{Op: "RunInstances", Phase: End, Manifest: "web", ClientToken: "b"},
+		{Op: "RunInstances", Phase: End, Manifest: "db"},
+		{Op: "TerminateInstances", Phase: End, Manifest: "cache"},
+	}}
+	var unfinished []string
+	for _, e := range j.Unfinished("RunInstances") {
+		unfinished = append(unfinished, e.Manifest+"/"+e.ClientToken)
+	}
+	if expect := []string{"web/a", "cache/"}; !reflect.DeepEqual(unfinished, expect) {
+		t.Errorf("unfinished %q (expected %q)", unfinished, expect)
+	}
+	if es := j.Unfinished("CreateTags"); len(es) != 1 {
+		t.Errorf("unfinished tags %v", es)
+	}
+}
+
+func TestSameRequest(t *testing.T) {
+	for _, test := range []struct {
+		begin, end Entry
+		same       bool
+	}{
+		{Entry{ClientToken: "a", Manifest: "web"}, Entry{ClientToken: "a", Manifest: "web"}, true},
+		{Entry{ClientToken: "a", Manifest: "web"}, Entry{ClientToken: "b", Manifest: "web"}, false},
+		{Entry{ClientToken: "a", Manifest: "web"}, Entry{Manifest: "web"}, false},
+		{Entry{Manifest: "web"}, Entry{Manifest: "web"}, true},
+		{Entry{Manifest: "web"}, Entry{Manifest: "db"}, false},
+	} {
+		if same := sameRequest(test.begin, test.end); same != test.same {
+			t.Errorf("%+v %+v: %v", test.begin, test.end, same)
+		}
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	dir := t.TempDir()
+	for i, name := range []string{"second", "first"} {
+		j, err := Create(dir, name, "launch", "", "us-east-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// journals are ordered by their start time, not their names.
+		j.Started = time.Date(2014, 3, 20, 0, 0, 0, 0, time.UTC).Add(-time.Duration(i) * time.Hour)
+		err = j.write()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := ioutil.WriteFile(filepath.Join(dir, "corrupt.json"), []byte(`{"Name": "corr`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journals, bad, err := ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journals) != 2 || journals[0].Name != "first" || journals[1].Name != "second" {
+		t.Errorf("journals %v", journals)
+	}
+	if len(bad) != 1 {
+		t.Errorf("bad %v", bad)
+	}
+
+	journals, bad, err = ReadDir(filepath.Join(dir, "missing"))
+	if err != nil || len(journals) != 0 || len(bad) != 0 {
+		t.Errorf("missing dir: %v %v %v", journals, bad, err)
+	}
+}
+
+func TestNilJournal(t *testing.T) {
+	var j *Journal
+	if j.Begin(Entry{Op: "RunInstances"}) != nil || j.End(Entry{}, nil) != nil || j.Remove() != nil {
+		t.Errorf("nil journal returned an error")
+	}
+	if j.Path() != "" || j.InstanceIds("RunInstances") != nil || j.Unfinished("RunInstances") != nil {
+		t.Errorf("nil journal is not empty")
+	}
+}
@@ -0,0 +1,278 @@
+/*
+structured output for oti commands.
+
+commands write their results as records, sequences of named fields.  records
+can be written in several formats
+
+	json   a json array of objects
+	jsonl  one json object per line
+	csv    comma separated values with a header row
+	table  columns aligned for humans with a header row
+
+any other format is treated as a text/template that is executed for each
+record.  fields are referenced by name (e.g. "{{.InstanceId}}").
+*/
+package otiout
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+)
+
+const (
+	JSON  = "json"
+	JSONL = "jsonl"
+	CSV   = "csv"
+	Table = "table"
+)
+
+// the named output formats
+var Formats = []string{JSON, JSONL, CSV, Table}
+
+type Field struct {
+	Name  string
+	Value interface{}
+}
+
+// an ordered set of fields.
+type Record []Field
+
+// returns the value of the named field or nil if r has no such field.
+func (r Record) Get(name string) interface{} {
+	for _, f := range r {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// sets the named field to v, appending a new field if r has no such field.
+// the updated record is returned.
+func (r Record) Set(name string, v interface{}) Record {
+	for i := range r {
+		if r[i].Name == name {
+			r[i].Value = v
+			return r
+		}
+	}
+	return append(r, Field{name, v})
+}
+
+// the field names of r in order.
+func (r Record) Names() []string {
+	names := make([]string, len(r))
+	for i := range r {
+		names[i] = r[i].Name
+	}
+	return names
+}
+
+// the record as a map, used as template data.
+func (r Record) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(r))
+	for _, f := range r {
+		m[f.Name] = f.Value
+	}
+	return m
+}
+
+// marshals r as a json object with keys in field order.
+func (r Record) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, f := range r {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		k, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteString(":")
+		buf.Write(v)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// formats a field value as text for csv and table output.  maps are written
+// as sorted, comma separated key=value pairs.  slices are comma separated.
+func String(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = k + "=" + v[k]
+		}
+		return strings.Join(pairs, ",")
+	case []string:
+		return strings.Join(v, ",")
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// writes records.  Writers are safe to use from multiple goroutines.  Close
+// must be called after the last record is written.
+type Writer interface {
+	Write(Record) error
+	Close() error
+}
+
+// returns a Writer for format.  if format is empty the deftmpl template is
+// used.  templates have a newline appended if they do not end with one.
+func New(w io.Writer, format, deftmpl string) (Writer, error) {
+	if format == "" {
+		format = deftmpl
+	}
+	var _w Writer
+	switch format {
+	case JSON:
+		_w = &jsonWriter{w: w}
+	case JSONL:
+		_w = &jsonlWriter{enc: json.NewEncoder(w)}
+	case CSV:
+		_w = &csvWriter{w: csv.NewWriter(w)}
+	case Table:
+		_w = &tableWriter{w: tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)}
+	default:
+		if !strings.HasSuffix(format, "\n") {
+			format += "\n"
+		}
+		t, err := template.New("output").Parse(format)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output format: %v", err)
+		}
+		_w = &templateWriter{w: w, t: t}
+	}
+	return &lockedWriter{w: _w}, nil
+}
+
+type lockedWriter struct {
+	mut sync.Mutex
+	w   Writer
+}
+
+func (w *lockedWriter) Write(r Record) error {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return w.w.Write(r)
+}
+
+func (w *lockedWriter) Close() error {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	return w.w.Close()
+}
+
+type jsonWriter struct {
+	w  io.Writer
+	rs []Record
+}
+
+func (w *jsonWriter) Write(r Record) error {
+	w.rs = append(w.rs, r)
+	return nil
+}
+
+func (w *jsonWriter) Close() error {
+	rs := w.rs
+	if rs == nil {
+		rs = []Record{}
+	}
+	p, err := json.MarshalIndent(rs, "", "\t")
+	if err != nil {
+		return err
+	}
+	p = append(p, '\n')
+	_, err = w.w.Write(p)
+	return err
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonlWriter) Write(r Record) error { return w.enc.Encode(r) }
+func (w *jsonlWriter) Close() error         { return nil }
+
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (w *csvWriter) Write(r Record) error {
+	if !w.header {
+		w.header = true
+		err := w.w.Write(r.Names())
+		if err != nil {
+			return err
+		}
+	}
+	row := make([]string, len(r))
+	for i := range r {
+		row[i] = String(r[i].Value)
+	}
+	return w.w.Write(row)
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type tableWriter struct {
+	w      *tabwriter.Writer
+	header bool
+}
+
+func (w *tableWriter) Write(r Record) error {
+	if !w.header {
+		w.header = true
+		_, err := fmt.Fprintln(w.w, strings.Join(r.Names(), "\t"))
+		if err != nil {
+			return err
+		}
+	}
+	row := make([]string, len(r))
+	for i := range r {
+		row[i] = String(r[i].Value)
+	}
+	_, err := fmt.Fprintln(w.w, strings.Join(row, "\t"))
+	return err
+}
+
+func (w *tableWriter) Close() error { return w.w.Flush() }
+
+type templateWriter struct {
+	w io.Writer
+	t *template.Template
+}
+
+func (w *templateWriter) Write(r Record) error { return w.t.Execute(w.w, r.Map()) }
+func (w *templateWriter) Close() error         { return nil }
@@ -0,0 +1,117 @@
+package otiout
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var testRecords = []Record{
+	{
+		{"InstanceId", "i-1"},
+		{"Tags", map[string]string{"b": "2", "a": "1"}},
+		{"Count", 2},
+	},
+	{
+		{"InstanceId", "i-2"},
+		{"Tags", map[string]string{"Note": `say "hi"`}},
+		{"Count", 10},
+	},
+}
+
+func TestFormats(t *testing.T) {
+	for _, test := range []struct {
+		format string
+		output string
+	}{
+		{JSON, `[
+	{
+		"InstanceId": "i-1",
+		"Tags": {
+			"a": "1",
+			"b": "2"
+		},
+		"Count": 2
+	},
+	{
+		"InstanceId": "i-2",
+		"Tags": {
+			"Note": "say \"hi\""
+		},
+		"Count": 10
+	}
+]
+`},
+		{JSONL, `{"InstanceId":"i-1","Tags":{"a":"1","b":"2"},"Count":2}
+{"InstanceId":"i-2","Tags":{"Note":"say \"hi\""},"Count":10}
+`},
+		{CSV, `InstanceId,Tags,Count
+i-1,"a=1,b=2",2
+i-2,"Note=say ""hi""",10
+`},
+		{Table, `InstanceId  Tags           Count
+i-1         a=1,b=2        2
+i-2         Note=say "hi"  10
+`},
+		{"{{.InstanceId}} {{.Count}}", "i-1 2\ni-2 10\n"},
+		{"{{.InstanceId}}\n", "i-1\ni-2\n"},
+	} {
+		var buf bytes.Buffer
+		w, err := New(&buf, test.format, "")
+		if err != nil {
+			t.Errorf("%q: %v", test.format, err)
+			continue
+		}
+		for _, r := range testRecords {
+			err := w.Write(r)
+			if err != nil {
+				t.Errorf("%q: %v", test.format, err)
+			}
+		}
+		err = w.Close()
+		if err != nil {
+			t.Errorf("%q: %v", test.format, err)
+		}
+		if buf.String() != test.output {
+			t.Errorf("%q: output\n%s\nexpected\n%s", test.format, buf.String(), test.output)
+		}
+	}
+}
+
+func TestEmptyJSON(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := New(&buf, JSON, "")
+	w.Close()
+	if buf.String() != "[]\n" {
+		t.Errorf("output %q", buf.String())
+	}
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := New(&buf, "", "{{.InstanceId}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(testRecords[0])
+	w.Close()
+	if buf.String() != "i-1\n" {
+		t.Errorf("output %q", buf.String())
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, "{{.InstanceId", "")
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid output format: ") {
+		t.Errorf("parse error %v", err)
+	}
+
+	w, err := New(&bytes.Buffer{}, `{{index .Tags 1}}`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Write(testRecords[0])
+	if err == nil {
+		t.Errorf("no execution error")
+	}
+}
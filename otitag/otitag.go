@@ -9,21 +9,44 @@ var Tags = []OTITag{
 	ResourceId,
 	SessionId,
 	Created,
+	IdempotencyKey,
+	AssumedRole,
 }
 
 const (
-	ResourceId OTITag = "ResourceId" // a unique identifier for the resource.
-	SessionId  OTITag = "SessionId"  // an identifier that groups oti resources.
-	Created    OTITag = "Created"    // an timestamp in RFC3339 format.
+	ResourceId     OTITag = "ResourceId"     // a unique identifier for the resource.
+	SessionId      OTITag = "SessionId"      // an identifier that groups oti resources.
+	Created        OTITag = "Created"        // an timestamp in RFC3339 format.
+	IdempotencyKey OTITag = "IdempotencyKey" // a user supplied key identifying a launch.
+	AssumedRole    OTITag = "AssumedRole"    // the arn of the iam role that created the resource.
 )
 
 // tags present only on instances
 var InstanceTags = []OTITag{
 	IImageId,
+	IManifest,
+	IIndex,
 }
 
 const (
-	IImageId OTITag = "Instance.ImageId" // ResourceId of a machine image
+	IImageId  OTITag = "Instance.ImageId"  // id of the machine image the instance was launched from
+	IManifest OTITag = "Instance.Manifest" // name of the launch manifest
+	IIndex    OTITag = "Instance.Index"    // ordinal of the instance among those launched for its manifest name
+)
+
+// tags present only on images
+var ImageTags = []OTITag{
+	MPromotions,
+	MCopiedFrom,
+	MCapturedFrom,
+	MSourceImageId,
+}
+
+const (
+	MPromotions    OTITag = "Image.Promotions"    // release channel changes, newest first (e.g. "stable@2014-03-20T15:04:05Z -staging@...")
+	MCopiedFrom    OTITag = "Image.CopiedFrom"    // region and id of the image a copy was made from (e.g. "us-east-1/ami-12345678")
+	MCapturedFrom  OTITag = "Image.CapturedFrom"  // address of the instance an image was captured from
+	MSourceImageId OTITag = "Image.SourceImageId" // id of the image a captured instance was launched from
 )
 
 // returns all tags; Tags, InstanceTags, etc.
@@ -31,6 +54,7 @@ func AllTags() []OTITag {
 	return concat(
 		Tags,
 		InstanceTags,
+		ImageTags,
 	)
 }
 
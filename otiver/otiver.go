@@ -0,0 +1,347 @@
+/*
+semantic versions and version constraints for oti images.
+
+versions have the form major.minor.patch[-prerelease][+build].  a leading "v"
+is allowed and missing minor or patch numbers are zero, so image version tags
+like "v1.4" parse.  as in semver, numbers cannot have leading zeros.
+
+constraints are lists of comparisons, all of which must hold.  alternatives
+are separated by "||".
+
+	1.4.2          exactly 1.4.2
+	1.4, 1.4.x     >=1.4.0 <1.5.0
+	~1.4           >=1.4.0 <1.5.0
+	~1.4.2         >=1.4.2 <1.5.0
+	^1.4.2         >=1.4.2 <2.0.0
+	>=2.0.0 <3     >=2.0.0 <3.0.0
+	!=1.4.3        anything but 1.4.3
+	*, ~*, ^*      any version
+
+prerelease versions only satisfy a constraint that mentions a prerelease of
+the same major.minor.patch.
+*/
+package otiver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string // prerelease identifiers (e.g. "rc.1")
+	Build               string // build metadata, ignored in comparisons
+}
+
+// parse a version.  see the package documentation.
+func Parse(s string) (Version, error) {
+	v, _, wild, err := parse(s)
+	if err != nil {
+		return Version{}, err
+	}
+	if wild {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+	return v, nil
+}
+
+// parse s returning the number of numeric components given.  wild is true if
+// a wildcard ("x", "X" or "*") follows them.
+func parse(s string) (v Version, n int, wild bool, err error) {
+	orig := s
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s, v.Build = s[:i], s[i+1:]
+		if !validIdentifiers(v.Build, false) {
+			return Version{}, 0, false, fmt.Errorf("invalid version %q", orig)
+		}
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		s, v.Pre = s[:i], s[i+1:]
+		if !validIdentifiers(v.Pre, true) {
+			return Version{}, 0, false, fmt.Errorf("invalid version %q", orig)
+		}
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 || s == "" {
+		return Version{}, 0, false, fmt.Errorf("invalid version %q", orig)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		if p == "x" || p == "X" || p == "*" {
+			if v.Pre != "" || i < len(parts)-1 {
+				return Version{}, 0, false, fmt.Errorf("invalid version %q", orig)
+			}
+			return v, i, true, nil
+		}
+		if !isNumber(p) || len(p) > 1 && p[0] == '0' {
+			return Version{}, 0, false, fmt.Errorf("invalid version %q", orig)
+		}
+		*nums[i], err = strconv.Atoi(p)
+		if err != nil {
+			return Version{}, 0, false, fmt.Errorf("invalid version %q", orig)
+		}
+	}
+	return v, len(parts), false, nil
+}
+
+// true if s is a non-empty string of digits.
+func isNumber(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// true if s is a list of dot separated identifiers made of alphanumerics and
+// hyphens.  numeric prerelease identifiers cannot have leading zeros.
+func validIdentifiers(s string, pre bool) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		for _, c := range id {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+				return false
+			}
+		}
+		if pre && isNumber(id) && len(id) > 1 && id[0] == '0' {
+			return false
+		}
+	}
+	return true
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// returns -1, 0 or 1 as a is less than, equal to or greater than b.
+func Compare(a, b Version) int {
+	for _, d := range []int{a.Major - b.Major, a.Minor - b.Minor, a.Patch - b.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return comparePre(a.Pre, b.Pre)
+}
+
+// a version without prerelease identifiers has higher precedence.
+// identifiers are compared numerically when both are numbers.
+func comparePre(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		anum, bnum := isNumber(as[i]), isNumber(bs[i])
+		an, _ := strconv.Atoi(as[i])
+		bn, _ := strconv.Atoi(bs[i])
+		switch {
+		case anum && bnum && an != bn:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case anum && !bnum:
+			return -1
+		case !anum && bnum:
+			return 1
+		case as[i] < bs[i]:
+			return -1
+		case as[i] > bs[i]:
+			return 1
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+type comparison struct {
+	op string
+	v  Version
+}
+
+func (c comparison) check(v Version) bool {
+	n := Compare(v, c.v)
+	switch c.op {
+	case "=":
+		return n == 0
+	case "!=":
+		return n != 0
+	case ">":
+		return n > 0
+	case ">=":
+		return n >= 0
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	}
+	return false
+}
+
+// a parsed version constraint.  see the package documentation.
+type Constraint struct {
+	s    string
+	alts [][]comparison
+}
+
+// parse a constraint.  see the package documentation.
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{s: s}
+	for _, alt := range strings.Split(s, "||") {
+		var cmps []comparison
+		for _, f := range strings.Fields(alt) {
+			_cmps, err := parseComparison(f)
+			if err != nil {
+				return Constraint{}, fmt.Errorf("constraint %q: %v", s, err)
+			}
+			cmps = append(cmps, _cmps...)
+		}
+		if len(cmps) == 0 {
+			return Constraint{}, fmt.Errorf("constraint %q: empty", s)
+		}
+		c.alts = append(c.alts, cmps)
+	}
+	return c, nil
+}
+
+func parseComparison(s string) ([]comparison, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", "!=", "==", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(s, prefix) {
+			op, s = prefix, s[len(prefix):]
+			break
+		}
+	}
+	v, n, _, err := parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if op == "==" {
+		op = "="
+	}
+	any := Version{Pre: "0"} // the lowest version
+
+	// the upper bound of a range beginning at v given its precision.
+	upper := func(precision int) Version {
+		switch precision {
+		case 1:
+			return Version{Major: v.Major + 1, Pre: "0"}
+		case 2:
+			return Version{Major: v.Major, Minor: v.Minor + 1, Pre: "0"}
+		}
+		return v
+	}
+	partial := n < 3
+	precision := n
+
+	// a bare wildcard ("*", "x") has no bounds.
+	if precision == 0 {
+		switch op {
+		case "", "=", "~", "^", ">=", "<=":
+			return []comparison{{">=", any}}, nil
+		}
+		return nil, fmt.Errorf("invalid comparison %q", op+s)
+	}
+
+	switch op {
+	case "", "=":
+		if !partial {
+			return []comparison{{"=", v}}, nil
+		}
+		return []comparison{{">=", v}, {"<", upper(precision)}}, nil
+	case "~":
+		if precision == 1 {
+			return []comparison{{">=", v}, {"<", upper(1)}}, nil
+		}
+		return []comparison{{">=", v}, {"<", upper(2)}}, nil
+	case "^":
+		switch {
+		case v.Major > 0 || precision == 1:
+			return []comparison{{">=", v}, {"<", upper(1)}}, nil
+		case v.Minor > 0 || precision == 2:
+			return []comparison{{">=", v}, {"<", upper(2)}}, nil
+		}
+		return []comparison{{"=", v}}, nil
+	case "<":
+		if partial {
+			v.Pre = "0"
+		}
+		return []comparison{{"<", v}}, nil
+	case ">":
+		if partial {
+			return []comparison{{">=", upper(precision)}}, nil
+		}
+		return []comparison{{">", v}}, nil
+	case "<=":
+		if partial {
+			return []comparison{{"<", upper(precision)}}, nil
+		}
+		return []comparison{{"<=", v}}, nil
+	case "!=":
+		if partial {
+			return nil, fmt.Errorf("invalid comparison %q", "!="+s)
+		}
+	}
+	return []comparison{{op, v}}, nil
+}
+
+// true if v satisfies c.
+func (c Constraint) Check(v Version) bool {
+	for _, cmps := range c.alts {
+		if checkAll(cmps, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkAll(cmps []comparison, v Version) bool {
+	if v.Pre != "" {
+		allowed := false
+		for _, c := range cmps {
+			if c.v.Pre != "" && c.v.Pre != "0" &&
+				c.v.Major == v.Major && c.v.Minor == v.Minor && c.v.Patch == v.Patch {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	for _, c := range cmps {
+		if !c.check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Constraint) String() string {
+	return c.s
+}
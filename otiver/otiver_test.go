@@ -0,0 +1,170 @@
+package otiver
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		s string
+		v Version
+	}{
+		{"1.4.2", Version{Major: 1, Minor: 4, Patch: 2}},
+		{"v1.4", Version{Major: 1, Minor: 4}},
+		{"2", Version{Major: 2}},
+		{"0.0.0", Version{}},
+		{"10.20.30", Version{Major: 10, Minor: 20, Patch: 30}},
+		{"1.0.0-rc.1", Version{Major: 1, Pre: "rc.1"}},
+		{"1.0.0-x-y.0", Version{Major: 1, Pre: "x-y.0"}},
+		{"1.0.0+build.001", Version{Major: 1, Build: "build.001"}},
+		{"1.0.0-beta+exp.sha.5114f85", Version{Major: 1, Pre: "beta", Build: "exp.sha.5114f85"}},
+	} {
+		v, err := Parse(test.s)
+		if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+		} else if v != test.v {
+			t.Errorf("%q: %+v (expected %+v)", test.s, v, test.v)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"v",
+		"01.2",
+		"1.02.3",
+		"1.2.03",
+		"1.2.3.4",
+		"1..3",
+		"1.2.",
+		"+1.2.3",
+		"1.-2.3",
+		"a.b.c",
+		"1.2.3-",
+		"1.2.3-01",
+		"1.2.3-rc..1",
+		"1.2.3-rc_1",
+		"1.2.3+",
+		"1.2.3+build..1",
+		"1.x",
+		"*",
+	} {
+		v, err := Parse(s)
+		if err == nil {
+			t.Errorf("%q: accepted as %v", s, v)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// in increasing order of precedence, from the semver specification.
+	ordered := []string{
+		"0.9.9",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.1.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a, b := mustParse(t, ordered[i]), mustParse(t, ordered[j])
+			expect := 0
+			switch {
+			case i < j:
+				expect = -1
+			case i > j:
+				expect = 1
+			}
+			if n := Compare(a, b); n != expect {
+				t.Errorf("Compare(%s, %s) = %d (expected %d)", a, b, n, expect)
+			}
+		}
+	}
+
+	if n := Compare(mustParse(t, "1.0.0+a"), mustParse(t, "1.0.0+b")); n != 0 {
+		t.Errorf("build metadata compared: %d", n)
+	}
+}
+
+func mustParse(t *testing.T, s string) Version {
+	v, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestConstraint(t *testing.T) {
+	for _, test := range []struct {
+		c     string
+		match []string
+		miss  []string
+	}{
+		{"1.4.2", []string{"1.4.2", "v1.4.2+b"}, []string{"1.4.3", "1.4.2-rc.1"}},
+		{"=1.4.2", []string{"1.4.2"}, []string{"1.4.1"}},
+		{"1.4", []string{"1.4.0", "1.4.9"}, []string{"1.3.9", "1.5.0", "1.4.0-rc.1"}},
+		{"1.4.x", []string{"1.4.0", "1.4.9"}, []string{"1.5.0"}},
+		{"1", []string{"1.0.0", "1.9.9"}, []string{"2.0.0", "0.9.9"}},
+		{"1.x", []string{"1.0.0", "1.9.9"}, []string{"2.0.0"}},
+		{"~1.4", []string{"1.4.0", "1.4.9"}, []string{"1.5.0", "1.3.0"}},
+		{"~1.4.2", []string{"1.4.2", "1.4.9"}, []string{"1.4.1", "1.5.0"}},
+		{"~1", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+		{"~*", []string{"0.0.0", "1.4.2", "99.0.0"}, []string{"1.0.0-rc.1"}},
+		{"^1.4.2", []string{"1.4.2", "1.9.0"}, []string{"1.4.1", "2.0.0"}},
+		{"^0.4.2", []string{"0.4.2", "0.4.9"}, []string{"0.5.0"}},
+		{"^0.0.2", []string{"0.0.2"}, []string{"0.0.3"}},
+		{"^0.x", []string{"0.0.1", "0.9.0"}, []string{"1.0.0"}},
+		{"^*", []string{"0.0.0", "3.0.0"}, nil},
+		{">=2.0.0 <3", []string{"2.0.0", "2.9.9"}, []string{"1.9.9", "3.0.0", "3.0.0-rc.1"}},
+		{">1.4", []string{"1.5.0"}, []string{"1.4.9"}},
+		{">1.4.2", []string{"1.4.3"}, []string{"1.4.2"}},
+		{"<=1.4", []string{"1.4.9", "1.0.0"}, []string{"1.5.0"}},
+		{"<1.4", []string{"1.3.9"}, []string{"1.4.0"}},
+		{"!=1.4.3", []string{"1.4.2", "1.4.4"}, []string{"1.4.3"}},
+		{"*", []string{"0.0.0", "1.4.2"}, []string{"1.4.2-rc.1"}},
+		{"x", []string{"2.0.0"}, nil},
+		{"<=*", []string{"2.0.0"}, nil},
+		{"1.4 || >=3", []string{"1.4.1", "3.0.0"}, []string{"2.0.0"}},
+		{">=1.0.0-rc.1 <1.0.0", []string{"1.0.0-rc.1", "1.0.0-rc.2"}, []string{"1.0.0", "1.0.1-rc.1"}},
+	} {
+		c, err := ParseConstraint(test.c)
+		if err != nil {
+			t.Errorf("%q: %v", test.c, err)
+			continue
+		}
+		for _, s := range test.match {
+			if !c.Check(mustParse(t, s)) {
+				t.Errorf("%q does not match %s", test.c, s)
+			}
+		}
+		for _, s := range test.miss {
+			if c.Check(mustParse(t, s)) {
+				t.Errorf("%q matches %s", test.c, s)
+			}
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"||",
+		"1.4 ||",
+		"!=1.4",
+		"<*",
+		">*",
+		"!=*",
+		"~01.4",
+		">=1.4.2.1",
+		"=>1.4",
+	} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("%q: accepted", s)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// output.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Output formats
+
+the sessions, instances, launch and terminate commands write their results to
+stdout as records.  the global -o option selects the output format.
+
+	oti -o json instances session-id
+	oti -o '{{.InstanceId}} {{.DNSName}}' instances session-id
+
+the formats are json, jsonl, csv, table, or a text/template executed for each
+record.  without -o each command writes its traditional tab or space separated
+lines.  field names are stable; records use the following fields as
+applicable.
+
+	SessionId     the oti session id
+	Region        the ec2 region name
+	InstanceId    the ec2 instance id
+	State         the instance state name
+	DNSName       the instance public dns name
+	Manifest      the launch manifest name
+	Index         the instance index among those launched for Manifest
+	Tags          the instance tags (an object in json)
+
+sessions records also have fields Profile, States, Pending, Running,
+ShuttingDown, Stopped and Terminated.  terminate records also have the field
+PreviousState.
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/otiout"
+	"github.com/bmatsuo/oti/otitag"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"os"
+)
+
+// returns a writer for command results in the format selected by -o.  if -o
+// was not given records are written with the template deftmpl.
+func NewOutput(deftmpl string) otiout.Writer {
+	w, err := otiout.New(os.Stdout, OutputFormat, deftmpl)
+	if err != nil {
+		Log.Fatal(err)
+	}
+	return w
+}
+
+// write a record to w, exiting on failure.
+func WriteOutput(w otiout.Writer, r otiout.Record) {
+	err := w.Write(r)
+	if err != nil {
+		Log.Fatal("error writing output: ", err)
+	}
+}
+
+// close w, exiting on failure.
+func CloseOutput(w otiout.Writer) {
+	err := w.Close()
+	if err != nil {
+		Log.Fatal("error writing output: ", err)
+	}
+}
+
+// true if the command's traditional output is being written.
+func DefaultOutput() bool {
+	return OutputFormat == ""
+}
+
+// true if records are written in a structured format (json, jsonl or csv)
+// that carries every field of a record.
+func StructuredOutput() bool {
+	switch OutputFormat {
+	case otiout.JSON, otiout.JSONL, otiout.CSV:
+		return true
+	}
+	return false
+}
+
+// the common fields describing an instance.
+func InstanceRecord(region string, inst *awsec2.Instance) otiout.Record {
+	tags := InstanceTags(inst)
+	return otiout.Record{
+		{Name: "SessionId", Value: tags[Config.Ec2Tag(otitag.SessionId)]},
+		{Name: "Manifest", Value: tags[Config.Ec2Tag(otitag.IManifest)]},
+		{Name: "Index", Value: tags[Config.Ec2Tag(otitag.IIndex)]},
+		{Name: "Region", Value: region},
+		{Name: "InstanceId", Value: inst.InstanceId},
+		{Name: "State", Value: inst.State.Name},
+		{Name: "DNSName", Value: inst.DNSName},
+		{Name: "Tags", Value: tags},
+	}
+}
+
+// the tags of inst as a map.
+func InstanceTags(inst *awsec2.Instance) map[string]string {
+	tags := make(map[string]string, len(inst.Tags))
+	for _, tag := range inst.Tags {
+		tags[tag.Key] = tag.Value
+	}
+	return tags
+}
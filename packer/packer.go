@@ -5,9 +5,11 @@ ssh in the future.
 package packer
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -16,26 +18,59 @@ import (
 
 type ErrorOutput []Output
 
-func (err ErrorOutput) Error() string { return fmt.Sprint([]Output(err)) }
+// the messages of ui error lines, if there are any.
+func (err ErrorOutput) Error() string {
+	var msgs []string
+	for _, o := range err {
+		if o.Type == "ui" && o.Data == "error" && len(o.Fields) > 1 {
+			msgs = append(msgs, strings.TrimSpace(o.Fields[1]))
+		}
+	}
+	if len(msgs) > 0 {
+		return strings.Join(msgs, "; ")
+	}
+	return fmt.Sprint([]Output(err))
+}
 
 func Command(name string, args ...string) *exec.Cmd {
 	_args := []string{"-machine-readable", name}
 	_args = append(_args, args...)
-	return exec.Command("packer", args...)
+	return exec.Command("packer", _args...)
 }
 
+// run cmd and decode its output.  ui lines are omitted except for errors,
+// which are kept so a failing command can be explained.
 func Run(cmd *exec.Cmd) ([]Output, error) {
+	return run(context.Background(), cmd, nil)
+}
+
+// like Run but ui lines are passed to ui, if it is not nil, and cmd is
+// interrupted when ctx is done.
+func run(ctx context.Context, cmd *exec.Cmd, ui func(Output)) ([]Output, error) {
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, err
 	}
-	d := NoUI(NewDecoder(stdout))
+	d := NewDecoder(stdout)
 
 	err = cmd.Start()
 	if err != nil {
 		return nil, err
 	}
 
+	exited := make(chan struct{})
+	defer close(exited)
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				// packer cleans up after an interrupt.  it is not killed.
+				cmd.Process.Signal(os.Interrupt)
+			case <-exited:
+			}
+		}()
+	}
+
 	var outs []Output
 	for {
 		o, err := d.Decode()
@@ -43,8 +78,17 @@ func Run(cmd *exec.Cmd) ([]Output, error) {
 			break
 		}
 		if err != nil {
+			cmd.Wait()
 			return nil, err
 		}
+		if o.Type == "ui" {
+			if ui != nil {
+				ui(o)
+			}
+			if o.Data != "error" {
+				continue
+			}
+		}
 		outs = append(outs, o)
 	}
 
@@ -85,6 +129,10 @@ type Opts struct {
 	Varfiles []string
 	Only     []string
 	Except   []string
+	Env      []string // added to the environment of packer (e.g. aws credentials)
+
+	Context context.Context // if not nil packer is interrupted when it is done
+	UI      func(Output)    // if not nil called with each ui line (say, message, error)
 }
 
 func Build(packerfile string, opts Opts) ([]Output, error) {
@@ -103,14 +151,77 @@ func Build(packerfile string, opts Opts) ([]Output, error) {
 	}
 	args = append(args, packerfile)
 
-	outs, err := Run(Command("build", args...))
+	cmd := Command("build", args...)
+	if len(opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), opts.Env...)
+	}
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	outs, err := run(ctx, cmd, opts.UI)
 	if err != nil {
+		if len(outs) == 0 {
+			return nil, err
+		}
 		return nil, ErrorOutput(outs)
 	}
 
 	return outs, nil
 }
 
+// an artifact produced by a build.
+type Artifact struct {
+	Builder   string // the name of the builder
+	Index     int
+	BuilderId string // e.g. "mitchellh.amazonebs"
+	Id        string // e.g. "us-east-1:ami-12345678,us-west-2:ami-87654321"
+	String    string
+}
+
+// returns the artifacts described in the output of a build.
+func Artifacts(outs []Output) []Artifact {
+	var arts []Artifact
+	index := make(map[string]int) // builder/index to position in arts
+	for _, o := range outs {
+		if o.Type != "artifact" || len(o.Fields) < 3 {
+			continue
+		}
+		n, err := strconv.Atoi(o.Fields[0])
+		if err != nil {
+			continue
+		}
+		key := o.Target + "/" + o.Fields[0]
+		i, ok := index[key]
+		if !ok {
+			i = len(arts)
+			index[key] = i
+			arts = append(arts, Artifact{Builder: o.Target, Index: n})
+		}
+		switch o.Fields[1] {
+		case "builder-id":
+			arts[i].BuilderId = o.Fields[2]
+		case "id":
+			arts[i].Id = o.Fields[2]
+		case "string":
+			arts[i].String = o.Fields[2]
+		}
+	}
+	return arts
+}
+
+// returns the images in the id of an amazon artifact by region.
+func AmazonImageIds(art Artifact) map[string]string {
+	ids := make(map[string]string)
+	for _, pair := range strings.Split(art.Id, ",") {
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) == 2 {
+			ids[kv[0]] = kv[1]
+		}
+	}
+	return ids
+}
+
 func NoUI(d Decoder) Decoder {
 	return decoderFunc(func() (Output, error) {
 		for {
@@ -135,7 +246,9 @@ type Decoder interface {
 }
 
 func NewDecoder(r io.Reader) Decoder {
-	return &decoder{csv.NewReader(r)}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // rows have a variable number of data fields
+	return &decoder{cr}
 }
 
 type decoder struct {
@@ -150,12 +263,10 @@ func (d *decoder) Decode() (Output, error) {
 	}
 	switch len(row) {
 	default:
-		fallthrough
-	case 4:
-		o.Data = row[3]
-		o.Data = strings.Replace(o.Data, `\r`, "\r", -1)
-		o.Data = strings.Replace(o.Data, `\n`, "\n", -1)
-		o.Data = strings.Replace(o.Data, `%!(PACKER_COMMA)`, ",", -1)
+		for _, f := range row[3:] {
+			o.Fields = append(o.Fields, unescape(f))
+		}
+		o.Data = o.Fields[0]
 		fallthrough
 	case 3:
 		o.Type = row[2]
@@ -179,5 +290,13 @@ type Output struct {
 	Time   time.Time
 	Target string
 	Type   string
-	Data   string
+	Data   string   // the first data field
+	Fields []string // all data fields
+}
+
+func unescape(s string) string {
+	s = strings.Replace(s, `\r`, "\r", -1)
+	s = strings.Replace(s, `\n`, "\n", -1)
+	s = strings.Replace(s, `%!(PACKER_COMMA)`, ",", -1)
+	return s
 }
@@ -0,0 +1,45 @@
+package packer
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunUI(t *testing.T) {
+	cmd := exec.Command("sh", "-c", `
+echo '1400000000,,ui,say,==> amazon-ebs: Prevalidating AMI Name...'
+echo '1400000001,amazon-ebs,artifact,0,id,us-east-1:ami-12345678'
+echo '1400000002,,ui,error,Build '"'"'amazon-ebs'"'"' errored: timeout%!(PACKER_COMMA) giving up'
+exit 1`)
+	var ui []string
+	outs, err := run(context.Background(), cmd, func(o Output) { ui = append(ui, o.Data) })
+	if err == nil {
+		t.Fatalf("no error")
+	}
+	if len(ui) != 2 || ui[0] != "say" || ui[1] != "error" {
+		t.Errorf("ui %q", ui)
+	}
+	if len(outs) != 2 || outs[0].Type != "artifact" {
+		t.Fatalf("outputs %v", outs)
+	}
+	msg := ErrorOutput(outs).Error()
+	if msg != "Build 'amazon-ebs' errored: timeout, giving up" {
+		t.Errorf("error %q", msg)
+	}
+}
+
+func TestRunInterrupt(t *testing.T) {
+	cmd := exec.Command("sh", "-c", `trap 'echo "1400000000,,ui,say,cleaning up"; exit 1' INT; while true; do sleep 0.01; done`)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	var ui []string
+	_, err := run(ctx, cmd, func(o Output) { ui = append(ui, o.Fields[1]) })
+	if err == nil {
+		t.Errorf("no error")
+	}
+	if len(ui) != 1 || ui[0] != "cleaning up" {
+		t.Errorf("ui %q", ui)
+	}
+}
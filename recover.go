@@ -0,0 +1,336 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// recover.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Recover interrupted commands
+
+the "recover" command finishes (or undoes) launch and terminate commands that
+did not complete.
+
+	oti recover [-terminate] [-n] [journal ...]
+
+oti keeps a journal for each launch and terminate command while it runs (in
+~/.oti/sessions unless the JournalDir config option is set).  a journal left
+behind means the command died part way through.  with no arguments every
+journal is recovered, otherwise only the named journals (a launch journal is
+named after its session id).
+
+for a launch, recover locates the instances created for the session, including
+those created by a RunInstances request whose response was never received, and
+applies any missing launch tags (session id, manifest name, index, image id,
+idempotency key and assumed role).  with -terminate the instances are
+terminated instead.  for a terminate, recover terminates any instances that
+are not already shutting down.  journals are removed once recovered.  journal
+files that cannot be read are reported and skipped.
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/otijournal"
+	"github.com/bmatsuo/oti/otisub"
+	"github.com/crowdmob/goamz/aws"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"flag"
+	"fmt"
+)
+
+var recovery = otisub.Register("recover", func(args []string) {
+	opts := new(RecoverOptions)
+	fs := otisub.FlagSet(flag.ExitOnError, "recover", "[journal ...]")
+	fs.BoolVar(&opts.Terminate, "terminate", false, "terminate instances of incomplete launches")
+	fs.BoolVar(&opts.DryRun, "n", false, "print actions without performing them")
+	fs.Parse(args)
+	args = fs.Args()
+
+	dir, err := Config.SessionJournalDir()
+	if err != nil {
+		Log.Fatal("error locating journals: ", err)
+	}
+	journals, bad, err := otijournal.ReadDir(dir)
+	if err != nil {
+		Log.Fatal("error reading journals: ", err)
+	}
+	haserrors := len(bad) > 0
+	for _, err := range bad {
+		Log.Printf("skipping unreadable journal: %v", err)
+	}
+	journals, err = selectJournals(journals, args)
+	if err != nil {
+		Log.Fatal(err)
+	}
+	if len(journals) == 0 {
+		Log.Println("nothing to recover")
+		if haserrors {
+			Log.Fatal()
+		}
+		return
+	}
+
+	for _, j := range journals {
+		err := RecoverJournal(j, opts)
+		if err != nil {
+			haserrors = true
+			Log.Printf("%s: %v", j.Name, err)
+		}
+	}
+	if haserrors {
+		Log.Fatal()
+	}
+})
+
+type RecoverOptions struct {
+	Terminate bool
+	DryRun    bool
+}
+
+func selectJournals(journals []*otijournal.Journal, names []string) ([]*otijournal.Journal, error) {
+	if len(names) == 0 {
+		return journals, nil
+	}
+	var js []*otijournal.Journal
+	for _, name := range names {
+		found := false
+		for _, j := range journals {
+			if j.Name == name {
+				js = append(js, j)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no journal %q", name)
+		}
+	}
+	return js, nil
+}
+
+// reconcile the journal with the instances that exist in EC2 and remove it.
+func RecoverJournal(j *otijournal.Journal, opts *RecoverOptions) error {
+	region, err := Config.AwsRegion(j.Region)
+	if err != nil {
+		return err
+	}
+	ec2, err := NewEC2(region)
+	if err != nil {
+		return err
+	}
+
+	switch j.Command {
+	case "launch":
+		err = recoverLaunch(ec2, j, opts)
+	case "terminate":
+		err = recoverTerminate(ec2, j, opts)
+	default:
+		err = fmt.Errorf("unknown command %q", j.Command)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+	return j.Remove()
+}
+
+func recoverLaunch(ec2 *awsec2.EC2, j *otijournal.Journal, opts *RecoverOptions) error {
+	if opts.Terminate {
+		insts, err := JournalInstances(ec2, j, "RunInstances")
+		if err != nil {
+			return err
+		}
+		return recoverTerminateInstances(ec2, j, insts, opts)
+	}
+
+	// requests that received a response name their instances.  requests
+	// that did not are located by client token.
+	launches := j.Unfinished("RunInstances")
+	for _, e := range j.Entries {
+		if e.Op == "RunInstances" && e.Phase == otijournal.End && len(e.InstanceIds) > 0 {
+			launches = append(launches, e)
+		}
+	}
+
+	for _, e := range launches {
+		filter := awsec2.NewFilter()
+		if len(e.InstanceIds) > 0 {
+			filter.Add("instance-id", e.InstanceIds...)
+		} else if e.ClientToken != "" {
+			filter.Add("client-token", e.ClientToken)
+		} else {
+			continue
+		}
+		resp, err := ec2.DescribeInstances(nil, filter)
+		if err != nil {
+			return err
+		}
+		for _, resvn := range resp.Reservations {
+			for i := range resvn.Instances {
+				err := recoverInstanceTags(ec2, j, e, &resvn.Instances[i], opts)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// apply any launch tags missing from inst.
+func recoverInstanceTags(ec2 *awsec2.EC2, j *otijournal.Journal, e otijournal.Entry, inst *awsec2.Instance, opts *RecoverOptions) error {
+	tags := SessionTags(SessionId(j.SessionId), e.Manifest, e.IdempotencyKey, e.AssumedRole)
+	tags = append(tags, IndexTag(e.IndexOffset+inst.AMILaunchIndex), ImageIdTag(inst.ImageId))
+	var missing []awsec2.Tag
+	for _, tag := range tags {
+		if instanceTag(inst, tag.Key) == "" {
+			missing = append(missing, tag)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	for _, tag := range missing {
+		fmt.Printf("%s %s tag %s=%s\n", j.Name, inst.InstanceId, tag.Key, tag.Value)
+	}
+	if opts.DryRun {
+		return nil
+	}
+	_, err := ec2.CreateTags([]string{inst.InstanceId}, missing)
+	return err
+}
+
+func recoverTerminate(ec2 *awsec2.EC2, j *otijournal.Journal, opts *RecoverOptions) error {
+	insts, err := JournalInstances(ec2, j, "TerminateInstances")
+	if err != nil {
+		return err
+	}
+	return recoverTerminateInstances(ec2, j, insts, opts)
+}
+
+func recoverTerminateInstances(ec2 *awsec2.EC2, j *otijournal.Journal, insts []awsec2.Instance, opts *RecoverOptions) error {
+	var ids []string
+	for _, inst := range insts {
+		switch inst.State.Name {
+		case "shutting-down", "terminated":
+		default:
+			ids = append(ids, inst.InstanceId)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if opts.DryRun {
+		for _, id := range ids {
+			fmt.Printf("%s %s terminate\n", j.Name, id)
+		}
+		return nil
+	}
+	resp, err := ec2.TerminateInstances(ids)
+	if err != nil {
+		return err
+	}
+	for _, change := range resp.StateChanges {
+		fmt.Printf("%s %s %s (was %s)\n",
+			j.Name,
+			change.InstanceId,
+			change.CurrentState.Name,
+			change.PreviousState.Name)
+	}
+	return nil
+}
+
+// locate the instances named in journal entries for op.  for RunInstances
+// requests that never received a response the instances are located by
+// client token.
+func JournalInstances(ec2 *awsec2.EC2, j *otijournal.Journal, op string) ([]awsec2.Instance, error) {
+	var insts []awsec2.Instance
+	seen := make(map[string]bool)
+	describe := func(filter *awsec2.Filter) error {
+		resp, err := ec2.DescribeInstances(nil, filter)
+		if err != nil {
+			return err
+		}
+		for _, resvn := range resp.Reservations {
+			for _, inst := range resvn.Instances {
+				if !seen[inst.InstanceId] {
+					seen[inst.InstanceId] = true
+					insts = append(insts, inst)
+				}
+			}
+		}
+		return nil
+	}
+
+	// a filter is used instead of instance ids because DescribeInstances
+	// fails if any given id no longer exists.
+	ids := j.InstanceIds(op)
+	if len(ids) > 0 {
+		filter := awsec2.NewFilter()
+		filter.Add("instance-id", ids...)
+		err := describe(filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, e := range j.Unfinished(op) {
+		if e.ClientToken == "" {
+			continue
+		}
+		filter := awsec2.NewFilter()
+		filter.Add("client-token", e.ClientToken)
+		err := describe(filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return insts, nil
+}
+
+func instanceTag(inst *awsec2.Instance, key string) string {
+	for _, tag := range inst.Tags {
+		if tag.Key == key {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+// create a journal in the configured journal directory.  journaling is a
+// safety net; if the journal cannot be created a warning is logged and nil is
+// returned.
+func CreateJournal(name, command string, sessionId SessionId, region aws.Region) *otijournal.Journal {
+	dir, err := Config.SessionJournalDir()
+	if err == nil {
+		var j *otijournal.Journal
+		j, err = otijournal.Create(dir, name, command, string(sessionId), region.Name)
+		if err == nil {
+			if DEBUG {
+				Log.Printf("journal: %s", j.Path())
+			}
+			return j
+		}
+	}
+	Log.Printf("warning: unable to create journal: %v", err)
+	return nil
+}
+
+// remove a journal after its command has finished.
+func RemoveJournal(j *otijournal.Journal) {
+	logJournalErr(j.Remove())
+}
+
+func logJournalErr(err error) {
+	if err != nil {
+		Log.Printf("warning: journal: %v", err)
+	}
+}
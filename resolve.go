@@ -0,0 +1,348 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// resolve.go [created: Mon, 19 Oct 2026]
+
+/*
+
+Image selection
+
+oti selects the image launched for a name from the images tagged with the name
+(Images.NameTag) using a strategy.  the select directive of `oti launch`
+chooses the strategy for a manifest.  the Images.Strategy config option sets
+the default.
+
+	latest     the latest build according to Images.BuildDateTag (default)
+	version    the highest version (Images.VersionTag) satisfying the version
+	           directive, ties are broken by build date.  implied by version=
+	id         the image given by the ami directive, which must have the name
+	created    the newest image according to the CreationDate ec2 reports
+
+build dates may be RFC3339 timestamps, unix seconds (packer's {{timestamp}}) or
+compact forms like 20140320T150405Z and 2014-03-20.  images that cannot be
+ranked by the strategy, and images that are not available (e.g. pending
+copies), are not selected.  with -debug oti logs every
+candidate considered and why it was rejected.
+
+*/
+package main
+
+import (
+	"github.com/bmatsuo/oti/otiver"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the default image selection strategy
+const DefaultImageStrategy = "latest"
+
+// an image selection strategy.
+type ImageStrategy interface {
+	// returns an error explaining why img cannot be selected.
+	Check(img *awsec2.Image) error
+
+	// true if a is preferred over b.  a and b passed Check.
+	Prefer(a, b *awsec2.Image) bool
+}
+
+// implemented by strategies that need image attributes goamz does not
+// decode.  Load is called with the images being resolved before Check.
+type imageLoader interface {
+	Load(ec2 *awsec2.EC2, images []awsec2.Image) error
+}
+
+// constructors for the image selection strategies, by name.  see the package
+// documentation.
+var ImageStrategies = map[string]func(r *ImageResolver) (ImageStrategy, error){
+	"latest":  newLatestStrategy,
+	"version": newVersionStrategy,
+	"id":      newIdStrategy,
+	"created": newCreatedStrategy,
+}
+
+// returns the names of ImageStrategies in order.
+func ImageStrategyNames() []string {
+	var names []string
+	for name := range ImageStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selects an image among those with a name.
+type ImageResolver struct {
+	Name     string // the image name, for messages
+	Strategy string // a key in ImageStrategies
+	Version  string // a version constraint for the "version" strategy
+	ImageId  string // the image for the "id" strategy
+	Channel  string // only consider images in this release channel
+}
+
+// a considered image.  Err is the reason an image was rejected.
+type ImageCandidate struct {
+	Image *awsec2.Image
+	Err   error
+}
+
+// the strategy name used by r.  when r.Strategy is empty the "version"
+// strategy is used if r.Version is set, otherwise Config.Images.Strategy or
+// DefaultImageStrategy.
+func (r *ImageResolver) StrategyName() string {
+	switch {
+	case r.Strategy != "":
+		return r.Strategy
+	case r.Version != "":
+		return "version"
+	case Config.Images.Strategy != "":
+		return Config.Images.Strategy
+	}
+	return DefaultImageStrategy
+}
+
+// locate the images named r.Name and return the preferred one.
+func (r *ImageResolver) Lookup(ec2 *awsec2.EC2) (*awsec2.Image, error) {
+	images, err := LookupImages(ec2, r.Name, r.Channel)
+	if err != nil {
+		return nil, fmt.Errorf("error locating image ids: %v", err)
+	}
+	image, _, err := r.Resolve(ec2, images)
+	return image, err
+}
+
+// returns the image with the given id.
+func LookupImageId(ec2 *awsec2.EC2, id string) (*awsec2.Image, error) {
+	resp, err := ec2.Images([]string{id}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Images) == 0 {
+		return nil, fmt.Errorf("image %s not found", id)
+	}
+	return &resp.Images[0], nil
+}
+
+// returns the preferred image in images, located in the region of ec2, and
+// the candidates considered, preferred first.  an error is returned if no
+// image can be selected.
+func (r *ImageResolver) Resolve(ec2 *awsec2.EC2, images []awsec2.Image) (*awsec2.Image, []ImageCandidate, error) {
+	name := r.StrategyName()
+	newStrategy, ok := ImageStrategies[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown image strategy %q (one of %s)", name, strings.Join(ImageStrategyNames(), ", "))
+	}
+	strategy, err := newStrategy(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if l, ok := strategy.(imageLoader); ok && len(images) > 0 {
+		err := l.Load(ec2, images)
+		if err != nil {
+			return nil, nil, fmt.Errorf("strategy %q: %v", name, err)
+		}
+	}
+
+	var selectable, rejected []ImageCandidate
+	for i := range images {
+		c := ImageCandidate{Image: &images[i]}
+		if state := images[i].State; state != "" && state != "available" {
+			c.Err = fmt.Errorf("image is %s", state)
+		} else {
+			c.Err = strategy.Check(&images[i])
+		}
+		if c.Err == nil {
+			selectable = append(selectable, c)
+		} else {
+			rejected = append(rejected, c)
+		}
+	}
+	sort.SliceStable(selectable, func(i, j int) bool {
+		return strategy.Prefer(selectable[i].Image, selectable[j].Image)
+	})
+	candidates := append(selectable, rejected...)
+
+	if DEBUG {
+		Log.Printf("%s: %d images considered by strategy %q", r.Name, len(candidates), name)
+		for _, c := range candidates {
+			if c.Err != nil {
+				Log.Printf("%s:   %s rejected: %v", r.Name, c.Image.Id, c.Err)
+			} else {
+				Log.Printf("%s:   %s build date %q version %q", r.Name, c.Image.Id,
+					imageTag(c.Image, Config.Images.BuildDateTag),
+					imageTag(c.Image, Config.Images.VersionTag))
+			}
+		}
+	}
+
+	if len(selectable) == 0 {
+		if len(images) == 0 {
+			return nil, candidates, fmt.Errorf("no images named %q", r.Name)
+		}
+		return nil, candidates, fmt.Errorf("none of %d images named %q can be selected by strategy %q (first rejected %s: %v)",
+			len(images), r.Name, name, rejected[0].Image.Id, rejected[0].Err)
+	}
+	return selectable[0].Image, candidates, nil
+}
+
+// layouts accepted for build dates, in addition to unix seconds.
+var BuildDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"20060102T150405Z",
+	"20060102T150405",
+	"20060102150405",
+	"2006-01-02",
+	"20060102",
+}
+
+// parse a build date tag value.  see BuildDateLayouts.
+func ParseBuildDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, fmt.Errorf("no build date")
+	}
+	// 8 digits are a date, not seconds.
+	if len(s) != 8 {
+		if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return time.Unix(secs, 0).UTC(), nil
+		}
+	}
+	for _, layout := range BuildDateLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized build date %q", s)
+}
+
+// the parsed build date of img, per Config.Images.BuildDateTag.
+func imageBuildDate(img *awsec2.Image) (time.Time, error) {
+	return ParseBuildDate(imageTag(img, Config.Images.BuildDateTag))
+}
+
+type latestStrategy struct{}
+
+func newLatestStrategy(r *ImageResolver) (ImageStrategy, error) {
+	if Config.Images.BuildDateTag == "" {
+		return nil, fmt.Errorf("no build date tag to order images")
+	}
+	return latestStrategy{}, nil
+}
+
+func (latestStrategy) Check(img *awsec2.Image) error {
+	_, err := imageBuildDate(img)
+	return err
+}
+
+func (latestStrategy) Prefer(a, b *awsec2.Image) bool {
+	ta, _ := imageBuildDate(a)
+	tb, _ := imageBuildDate(b)
+	return ta.After(tb)
+}
+
+type versionStrategy struct {
+	constraint *otiver.Constraint
+}
+
+func newVersionStrategy(r *ImageResolver) (ImageStrategy, error) {
+	if Config.Images.VersionTag == "" {
+		return nil, fmt.Errorf("no version tag to identify images with")
+	}
+	s := versionStrategy{}
+	if r.Version != "" {
+		c, err := otiver.ParseConstraint(r.Version)
+		if err != nil {
+			return nil, err
+		}
+		s.constraint = &c
+	}
+	return s, nil
+}
+
+func (s versionStrategy) Check(img *awsec2.Image) error {
+	v, err := otiver.Parse(imageTag(img, Config.Images.VersionTag))
+	if err != nil {
+		return err
+	}
+	if s.constraint != nil && !s.constraint.Check(v) {
+		return fmt.Errorf("version %s does not satisfy %q", v, s.constraint)
+	}
+	return nil
+}
+
+// images with equal versions are ordered by build date.  images without a
+// build date come last.
+func (s versionStrategy) Prefer(a, b *awsec2.Image) bool {
+	va, _ := otiver.Parse(imageTag(a, Config.Images.VersionTag))
+	vb, _ := otiver.Parse(imageTag(b, Config.Images.VersionTag))
+	if n := otiver.Compare(va, vb); n != 0 {
+		return n > 0
+	}
+	ta, erra := imageBuildDate(a)
+	tb, errb := imageBuildDate(b)
+	if erra != nil || errb != nil {
+		return erra == nil && errb != nil
+	}
+	return ta.After(tb)
+}
+
+type idStrategy struct {
+	id string
+}
+
+func newIdStrategy(r *ImageResolver) (ImageStrategy, error) {
+	if r.ImageId == "" {
+		return nil, fmt.Errorf(`strategy "id" needs an image id (ami=)`)
+	}
+	return idStrategy{r.ImageId}, nil
+}
+
+func (s idStrategy) Check(img *awsec2.Image) error {
+	if img.Id != s.id {
+		return fmt.Errorf("not %s", s.id)
+	}
+	return nil
+}
+
+func (idStrategy) Prefer(a, b *awsec2.Image) bool { return false }
+
+// goamz does not decode the CreationDate of images so the dates are requested
+// separately.  see DescribeImageCreationDates.
+type createdStrategy struct {
+	dates map[string]time.Time
+}
+
+func newCreatedStrategy(r *ImageResolver) (ImageStrategy, error) {
+	return &createdStrategy{}, nil
+}
+
+func (s *createdStrategy) Load(ec2 *awsec2.EC2, images []awsec2.Image) error {
+	ids := make([]string, len(images))
+	for i := range images {
+		ids[i] = images[i].Id
+	}
+	dates, err := DescribeImageCreationDates(ec2, ids)
+	if err != nil {
+		return err
+	}
+	s.dates = dates
+	return nil
+}
+
+func (s *createdStrategy) Check(img *awsec2.Image) error {
+	if _, ok := s.dates[img.Id]; !ok {
+		return fmt.Errorf("no creation date")
+	}
+	return nil
+}
+
+func (s *createdStrategy) Prefer(a, b *awsec2.Image) bool {
+	return s.dates[a.Id].After(s.dates[b.Id])
+}
@@ -14,14 +14,18 @@ the "sessions" command provides information about known oti sessions and their
 resources. resources are identified by tag values.
 
 	oti sessions -h
+	oti sessions [session-id[/name[/index]] ...]
 
 locates existing sessions. sessions exists merely by having instances tagged
-with their session id.
+with their session id.  with -all-profiles sessions are located using every
+profile in the config (see the oticonfig package).  when instance addresses
+are given only the addressed instances are counted.
 
 */
 package main
 
 import (
+	"github.com/bmatsuo/oti/otiout"
 	"github.com/bmatsuo/oti/otisub"
 	"github.com/bmatsuo/oti/otitag"
 	"github.com/crowdmob/goamz/aws"
@@ -34,54 +38,97 @@ import (
 
 var sessions = otisub.Register("sessions", func(args []string) {
 	fs := otisub.FlagSet(flag.ExitOnError, "sessions", "[sessionid ...]")
+	allProfiles := fs.Bool("all-profiles", false, "locate sessions using every config profile")
 	fs.Parse(args)
 
-	sessionids := fs.Args()
-
-	awsauth, err := Config.AwsAuth()
+	addrs, err := ParseInstanceAddresses(fs.Args())
 	if err != nil {
-		Log.Fatalf("error reading aws credentials: %v", err)
+		Log.Fatal(err)
 	}
 
-	wg := new(sync.WaitGroup)
-	for _, r := range Ec2Regions(false) {
-		r := r
-		wg.Add(1)
-		go func() {
-			SessionsMain(awsauth, r, sessionids)
-			wg.Done()
-		}()
+	profiles := []string{ProfileName}
+	deftmpl := "{{.Region}}\t{{.SessionId}}\t{{.States}}"
+	if *allProfiles {
+		profiles = RawConfig.ProfileNames()
+		deftmpl = "{{.Profile}}\t" + deftmpl
 	}
-	wg.Wait()
+
+	out := NewOutput(deftmpl)
+	for _, p := range profiles {
+		// profiles are scanned one at a time because Config is global.
+		err := UseProfile(p)
+		if err != nil {
+			Log.Fatal(err)
+		}
+
+		wg := new(sync.WaitGroup)
+		for _, r := range Ec2Regions(false) {
+			r := r
+			wg.Add(1)
+			go func() {
+				SessionsMain(r, addrs, out)
+				wg.Done()
+			}()
+		}
+		wg.Wait()
+	}
+	CloseOutput(out)
 })
 
 var isAwsUsGovRegion = map[string]bool{"us-gov-west-1": true}
 
+// the regions scanned for resources.  custom regions in Config are included
+// and replace goamz regions with the same name.
 func Ec2Regions(usgov bool) []aws.Region {
-	rs := make([]aws.Region, 0, len(aws.Regions))
+	custom := Config.CustomAwsRegions()
+	if Config.Ec2.OnlyCustomRegions {
+		return custom
+	}
+	rs := make([]aws.Region, 0, len(aws.Regions)+len(custom))
 	for k := range aws.Regions {
 		if isAwsUsGovRegion[k] && !usgov {
 			// shhh
 			continue
 		}
+		if Config.Ec2CustomRegion(aws.Regions[k]) != nil {
+			continue
+		}
 		if aws.Regions[k].EC2Endpoint != "" {
 			rs = append(rs, aws.Regions[k])
 		}
 	}
-	return rs
+	return append(rs, custom...)
 }
 
 // locate and inspect sessions, active or terminated
-func SessionsMain(auth aws.Auth, region aws.Region, sessionids []string) {
-	ec2 := awsec2.New(auth, region)
-	sessions, err := LocateSessions(ec2, sessionids)
+func SessionsMain(region aws.Region, addrs []InstanceAddress, out otiout.Writer) {
+	ec2, err := NewEC2(region)
+	if err != nil {
+		Log.Fatalf("error reading aws credentials: %v", err)
+	}
+	sessions, err := LocateSessions(ec2, addrs)
 	if err != nil {
 		Log.Fatalln("error locating instances: ", err)
 	}
 
-	// print session details to stdout
+	// write session details to stdout
 	for _, s := range sessions {
-		fmt.Printf("%s\t%s\t%s\n", region.Name, s.Id, DescribeSessionInstanceStates(s))
+		WriteOutput(out, SessionRecord(region.Name, s))
+	}
+}
+
+func SessionRecord(region string, s Session) otiout.Record {
+	counts := SessionInstanceStateCounts(s)
+	return otiout.Record{
+		{Name: "Profile", Value: ProfileName},
+		{Name: "SessionId", Value: s.Id},
+		{Name: "Region", Value: region},
+		{Name: "States", Value: DescribeSessionInstanceStates(s)},
+		{Name: "Pending", Value: counts["pending"]},
+		{Name: "Running", Value: counts["running"]},
+		{Name: "ShuttingDown", Value: counts["shutting-down"]},
+		{Name: "Stopped", Value: counts["stopped"]},
+		{Name: "Terminated", Value: counts["terminated"]},
 	}
 }
 
@@ -90,11 +137,13 @@ type Session struct {
 	Instances []awsec2.Instance
 }
 
-func LocateSessions(ec2 *awsec2.EC2, sessions []string) ([]Session, error) {
+// locate sessions and their instances.  if addresses are given only the
+// addressed instances are included.
+func LocateSessions(ec2 *awsec2.EC2, addrs []InstanceAddress) ([]Session, error) {
 	sessionIdTag := Config.Ec2Tag(otitag.SessionId)
 	filter := awsec2.NewFilter()
-	if len(sessions) > 0 {
-		filter.Add("tag:"+sessionIdTag, sessions...)
+	if len(addrs) > 0 {
+		filter.Add("tag:"+sessionIdTag, AddressSessionIds(addrs)...)
 	} else {
 		filter.Add("tag-key", Config.Ec2Tag(otitag.SessionId))
 	}
@@ -106,6 +155,9 @@ func LocateSessions(ec2 *awsec2.EC2, sessions []string) ([]Session, error) {
 	simap := make(map[SessionId][]awsec2.Instance)
 	for _, rsvn := range resp.Reservations {
 		for _, inst := range rsvn.Instances {
+			if len(addrs) > 0 && !MatchAnyAddress(addrs, &inst) {
+				continue
+			}
 			for _, tag := range inst.Tags {
 				if tag.Key == sessionIdTag {
 					sessionId := SessionId(tag.Value)
@@ -124,11 +176,17 @@ func LocateSessions(ec2 *awsec2.EC2, sessions []string) ([]Session, error) {
 	return ss, nil
 }
 
-func DescribeSessionInstanceStates(s Session) string {
+// the number of session instances in each state.
+func SessionInstanceStateCounts(s Session) map[string]int {
 	counts := make(map[string]int, 5)
 	for _, inst := range s.Instances {
 		counts[inst.State.Name]++
 	}
+	return counts
+}
+
+func DescribeSessionInstanceStates(s Session) string {
+	counts := SessionInstanceStateCounts(s)
 	return fmt.Sprintf("%d/%d/%d/%d/%d",
 		counts["pending"], counts["running"],
 		counts["shutting-down"], counts["stopped"],
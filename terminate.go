@@ -12,24 +12,34 @@ the "terminate" command can be used to terminate oti sessions.
 
 	oti terminate -s session-type
 	oti terminate session-id ...
+	oti terminate session-id/name[/index] ...
 
 when -s is given oti terminates all sessions of a given type.  when session
 id(s) are specified oti terminates all instances belonging to the session(s).
+when instance addresses are given only the addressed instances are terminated.
 if all instances in the given sessions enter the 'shutting-down' state, the
 command will exit with a zero exit status.
 
+if oti-terminate is interrupted before it sends the termination request no
+instances are terminated.  the request is recorded in a journal until it
+completes (see `oti recover`).
+
 */
 package main
 
 import (
+	"github.com/bmatsuo/oti/otijournal"
+	"github.com/bmatsuo/oti/otiout"
 	"github.com/bmatsuo/oti/otisub"
 	"github.com/bmatsuo/oti/otitag"
 	"github.com/crowdmob/goamz/aws"
 	awsec2 "github.com/crowdmob/goamz/ec2"
 
+	"context"
 	"flag"
 	"fmt"
 	"strings"
+	"time"
 )
 
 var terminate = otisub.Register("terminate", func(args []string) {
@@ -38,7 +48,7 @@ var terminate = otisub.Register("terminate", func(args []string) {
 	exceptstates := fs.String("except-states", "shutting-down,terminated", "do not try to terminate these instances")
 	onlystates := fs.String("only-states", "*", "terminate only instances in one of these states")
 	fs.StringVar(&opts.SessionType, "s", "", "terminate all sessions with this type")
-	region := fs.String("r", "us-east-1", "ec2 region to look for instances")
+	region := fs.String("r", Config.Ec2.DefaultRegion, "ec2 region to look for instances")
 	fs.BoolVar(&opts.WaitShuttingDown, "w", false, "wait while instances are 'shutting-down'")
 	fs.Parse(args)
 	args = fs.Args()
@@ -46,37 +56,39 @@ var terminate = otisub.Register("terminate", func(args []string) {
 	opts.ExceptStates = strings.Split(*exceptstates, ",")
 	opts.OnlyStates = strings.Split(*onlystates, ",")
 
-	auth, err := Config.AwsAuth()
+	var err error
+	opts.Region, err = Config.AwsRegion(*region)
 	if err != nil {
-		Log.Fatal("error reading aws credentials: ", err)
+		Log.Fatal(err)
 	}
-	opts.Auth = auth
 
-	opts.Region = aws.Regions[*region]
-	if opts.Region.Name == "" {
-		Log.Fatal("unknown ec2 region %q", *region)
-	}
+	ctx, stop := InterruptContext()
+	defer stop()
 
-	TerminateMain(args, opts)
+	TerminateMain(ctx, args, opts)
 })
 
 type TerminateOptions struct {
 	Region           aws.Region
-	Auth             aws.Auth
 	ExceptStates     []string
 	OnlyStates       []string
 	SessionType      string
 	WaitShuttingDown bool
 }
 
-// takes a list of target identifiers to terminate and options.
-func TerminateMain(targets []string, opts *TerminateOptions) {
+// takes a list of target identifiers to terminate and options.  if ctx is
+// canceled before instances are terminated the process exits without
+// terminating anything.
+func TerminateMain(ctx context.Context, targets []string, opts *TerminateOptions) {
 	if len(targets) == 0 && opts.SessionType == "" {
 		Log.Println("no targets...")
 		return
 	}
 
-	ec2 := awsec2.New(opts.Auth, opts.Region)
+	ec2, err := NewEC2(opts.Region)
+	if err != nil {
+		Log.Fatal("error reading aws credentials: ", err)
+	}
 
 	resvns, err := LocateTargetInstances(ec2, targets, opts.SessionType, opts.OnlyStates, opts.ExceptStates)
 	if err != nil {
@@ -88,9 +100,12 @@ func TerminateMain(targets []string, opts *TerminateOptions) {
 	}
 
 	instanceIds := make([]string, 0)
-	for _, resvn := range resvns {
-		for _, inst := range resvn.Instances {
+	instances := make(map[string]*awsec2.Instance)
+	for i := range resvns {
+		for j := range resvns[i].Instances {
+			inst := &resvns[i].Instances[j]
 			instanceIds = append(instanceIds, inst.InstanceId)
+			instances[inst.InstanceId] = inst
 		}
 	}
 
@@ -99,21 +114,36 @@ func TerminateMain(targets []string, opts *TerminateOptions) {
 		return
 	}
 
+	if ctx.Err() != nil {
+		Log.Fatal("interrupted; no instances terminated")
+	}
+
 	if DEBUG {
 		Log.Printf("terminating instances %v", instanceIds)
 	}
 
+	journalName := "terminate-" + time.Now().UTC().Format("20060102T150405.000000000")
+	journal := CreateJournal(journalName, "terminate", "", opts.Region)
+	entry := otijournal.Entry{Op: "TerminateInstances", InstanceIds: instanceIds}
+	logJournalErr(journal.Begin(entry))
 	resp, err := ec2.TerminateInstances(instanceIds)
+	logJournalErr(journal.End(entry, err))
 	if err != nil {
 		Log.Fatal(err)
 	}
+	RemoveJournal(journal)
 
+	out := NewOutput("{{.InstanceId}} {{.State}} (was {{.PreviousState}})")
 	for _, change := range resp.StateChanges {
-		Log.Printf("%s %s (was %s)",
-			change.InstanceId,
-			change.CurrentState.Name,
-			change.PreviousState.Name)
+		r := otiout.Record{{Name: "InstanceId", Value: change.InstanceId}}
+		if inst := instances[change.InstanceId]; inst != nil {
+			r = InstanceRecord(opts.Region.Name, inst)
+		}
+		r = r.Set("State", change.CurrentState.Name)
+		r = r.Set("PreviousState", change.PreviousState.Name)
+		WriteOutput(out, r)
 	}
+	CloseOutput(out)
 }
 
 // find instances tagged with target session ids
@@ -126,11 +156,16 @@ func LocateTargetInstances(ec2 *awsec2.EC2, targets []string, sessiontype string
 		return nil, fmt.Errorf("no target tessions")
 	}
 
+	addrs, err := ParseInstanceAddresses(targets)
+	if err != nil {
+		return nil, err
+	}
+
 	sessionidtag := Config.Ec2Tag(otitag.SessionId)
 
 	filter := awsec2.NewFilter()
-	for i := range targets {
-		filter.Add("tag:"+sessionidtag, targets[i])
+	for _, sid := range AddressSessionIds(addrs) {
+		filter.Add("tag:"+sessionidtag, sid)
 	}
 	if sessiontype != "" {
 		filter.Add("tag-key", sessionidtag)
@@ -161,19 +196,10 @@ func LocateTargetInstances(ec2 *awsec2.EC2, targets []string, sessiontype string
 		resp.Reservations[i].Instances = FilterInstances(FilterInstances(FilterInstances(
 			resp.Reservations[i].Instances,
 			func(inst *awsec2.Instance) bool {
-				for _, tag := range inst.Tags {
-					if tag.Key == sessionidtag {
-						if SessionId(tag.Value).Type() == sessiontype {
-							return true
-						}
-						if DEBUG {
-							Log.Printf("discarding instance %q with tag %v",
-								inst.InstanceId, tag)
-						}
-						return false
-					}
+				if len(addrs) > 0 && !MatchAnyAddress(addrs, inst) {
+					return false
 				}
-				return false
+				return MatchSessionType(inst, sessiontype)
 			}),
 			matchesState(onlystates)),
 			func(inst *awsec2.Instance) bool {
@@ -187,6 +213,25 @@ func LocateTargetInstances(ec2 *awsec2.EC2, targets []string, sessiontype string
 	return resp.Reservations, nil
 }
 
+// whether inst belongs to a session of the given type.  any session matches
+// an empty sessiontype.
+func MatchSessionType(inst *awsec2.Instance, sessiontype string) bool {
+	sessionidtag := Config.Ec2Tag(otitag.SessionId)
+	for _, tag := range inst.Tags {
+		if tag.Key == sessionidtag {
+			if sessiontype == "" || SessionId(tag.Value).Type() == sessiontype {
+				return true
+			}
+			if DEBUG {
+				Log.Printf("discarding instance %q with tag %v",
+					inst.InstanceId, tag)
+			}
+			return false
+		}
+	}
+	return false
+}
+
 func FilterReservations(rs []awsec2.Reservation, fn func(*awsec2.Reservation) bool) []awsec2.Reservation {
 	_rs := make([]awsec2.Reservation, 0, len(rs))
 	for i := range rs {
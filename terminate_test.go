@@ -0,0 +1,44 @@
+// Copyright 2014, Bryan Matsuo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/bmatsuo/oti/otitag"
+	awsec2 "github.com/crowdmob/goamz/ec2"
+
+	"testing"
+)
+
+func TestMatchSessionType(t *testing.T) {
+	tag := Config.Ec2Tag(otitag.SessionId)
+	session := &awsec2.Instance{
+		InstanceId: "i-1",
+		Tags:       []awsec2.Tag{{Key: tag, Value: "session:1234"}},
+	}
+	ci := &awsec2.Instance{
+		InstanceId: "i-2",
+		Tags:       []awsec2.Tag{{Key: tag, Value: "ci:5678"}},
+	}
+	untagged := &awsec2.Instance{InstanceId: "i-3"}
+
+	for _, test := range []struct {
+		inst        *awsec2.Instance
+		sessiontype string
+		match       bool
+	}{
+		{session, "", true},
+		{ci, "", true},
+		{untagged, "", false},
+		{session, "session", true},
+		{ci, "session", false},
+		{ci, "ci", true},
+		{untagged, "ci", false},
+	} {
+		match := MatchSessionType(test.inst, test.sessiontype)
+		if match != test.match {
+			t.Errorf("%s %q: got %v", test.inst.InstanceId, test.sessiontype, match)
+		}
+	}
+}